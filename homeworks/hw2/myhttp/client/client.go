@@ -1,15 +1,180 @@
 package client
 
 import (
+	"context"
+	"errors"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 )
 
-func New() HTTPClient {
-	return &myClient{}
+// New создает клиент с пулом keep-alive соединений
+func New(opts ...Option) HTTPClient {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &myClient{
+		transport:     newTransport(o),
+		checkRedirect: o.checkRedirect,
+		jar:           o.jar,
+		timeout:       o.timeout,
+		retry:         o.retry,
+	}
 }
 
-type myClient struct{}
+type myClient struct {
+	transport     *transport
+	checkRedirect func(req *http.Request, via []*http.Request) error
+	jar           http.CookieJar
+	timeout       time.Duration
+	retry         RetryPolicy
+}
 
+// Do отправляет запрос и идет по редиректам, как http.Client.
+// resp.Request у возвращенного ответа - последний отправленный запрос.
+// Отмена req.Context() или истечение WithTimeout прерывают запрос на любом этапе, включая
+// чтение тела ответа. Ошибки возвращаются обернутыми в *url.Error.
+// Как и net/http, клиент вызывает колбэки httptrace.ClientTrace из req.Context().
+// С WithRetry каждый запрос цепочки повторяется отдельно, а WithTimeout ограничивает все попытки вместе.
 func (m *myClient) Do(req *http.Request) (*http.Response, error) {
-	panic("TODO: implement me")
+	if req == nil || req.URL == nil {
+		return m.transport.roundTrip(req)
+	}
+	if m.timeout <= 0 {
+		return m.do(req)
+	}
+
+	// таймаут действует, пока не дочитано тело ответа
+	ctx, cancel := context.WithTimeout(req.Context(), m.timeout)
+	resp, err := m.do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return resp, err
+	}
+	resp.Body = &cancelTimerBody{rc: resp.Body, stop: cancel}
+	return resp, nil
+}
+
+// do идет по цепочке редиректов
+func (m *myClient) do(req *http.Request) (*http.Response, error) {
+	var (
+		ireq   = req // исходный запрос
+		header = req.Header.Clone()
+		via    []*http.Request
+		resp   *http.Response
+
+		redirectMethod string
+		includeBody    bool
+	)
+	if header == nil {
+		header = make(http.Header)
+	}
+	uerr := func(u *url.URL, err error) error {
+		return &url.Error{Op: urlErrorOp(ireq.Method), URL: u.String(), Err: err}
+	}
+	for {
+		if len(via) > 0 {
+			next, err := newRedirectRequest(ireq, req, resp, header, redirectMethod, includeBody)
+			if err != nil {
+				discardBody(resp.Body)
+				return nil, uerr(req.URL, err)
+			}
+			err = m.redirectAllowed(next, via)
+			if errors.Is(err, http.ErrUseLastResponse) {
+				return resp, nil
+			}
+			discardBody(resp.Body)
+			if err != nil {
+				// как и http.Client, отдаем последний ответ вместе с ошибкой, тело уже закрыто
+				return resp, uerr(next.URL, err)
+			}
+			req = next
+		}
+
+		via = append(via, req)
+		var err error
+		resp, err = m.sendWithRetry(req)
+		if err != nil {
+			return nil, uerr(req.URL, err)
+		}
+
+		var shouldRedirect bool
+		redirectMethod, shouldRedirect, includeBody = redirectBehavior(req.Method, resp, ireq)
+		if !shouldRedirect {
+			return resp, nil
+		}
+	}
+}
+
+// send отправляет один запрос, подставляя cookie из jar и сохраняя в него cookie из ответа
+func (m *myClient) send(req *http.Request) (*http.Response, error) {
+	if m.jar == nil {
+		return m.transport.roundTrip(req)
+	}
+
+	if cookies := m.jar.Cookies(req.URL); len(cookies) > 0 {
+		// заголовки вызывающего не трогаем
+		r2 := *req
+		r2.Header = req.Header.Clone()
+		if r2.Header == nil {
+			r2.Header = make(http.Header)
+		}
+		for _, cookie := range cookies {
+			r2.AddCookie(cookie)
+		}
+		req = &r2
+	}
+	resp, err := m.transport.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		m.jar.SetCookies(req.URL, cookies)
+	}
+	return resp, nil
+}
+
+func (m *myClient) redirectAllowed(req *http.Request, via []*http.Request) error {
+	if m.checkRedirect != nil {
+		return m.checkRedirect(req, via)
+	}
+	return defaultCheckRedirect(req, via)
+}
+
+// CloseIdleConnections закрывает соединения, простаивающие в пуле
+func (m *myClient) CloseIdleConnections() {
+	m.transport.closeIdleConnections()
+}
+
+// urlErrorOp возвращает Op для *url.Error: "Get", "Post" и т.д., как у http.Client
+func urlErrorOp(method string) string {
+	if method == "" {
+		return "Get"
+	}
+	return method[:1] + strings.ToLower(method[1:])
+}
+
+// cancelTimerBody снимает таймаут клиента, когда тело ответа дочитано или закрыто
+type cancelTimerBody struct {
+	rc   io.ReadCloser
+	stop context.CancelFunc
+	once sync.Once
+}
+
+func (b *cancelTimerBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if err == io.EOF {
+		b.once.Do(b.stop)
+	}
+	return n, err
+}
+
+func (b *cancelTimerBody) Close() error {
+	err := b.rc.Close()
+	b.once.Do(b.stop)
+	return err
 }
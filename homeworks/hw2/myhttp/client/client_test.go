@@ -1,19 +1,38 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
 	"net/url"
 	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
 	"time"
 
 	"github.com/phayes/freeport"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
 )
 
 const (
@@ -272,3 +291,1565 @@ func Test_myClient_Do_RealHTTP(t *testing.T) {
 		})
 	}
 }
+
+func Test_myClient_Do_ConnectionReuse(t *testing.T) {
+	get := func(t *testing.T, c HTTPClient, rawURL string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	readAll := func(t *testing.T, resp *http.Response) string {
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	tests := []struct {
+		name      string
+		opts      []Option
+		do        func(t *testing.T, c HTTPClient, baseURL string)
+		wantConns int
+	}{
+		{
+			name: "success: sequential requests share one connection",
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				for i := 0; i < 3; i++ {
+					assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+				}
+			},
+			wantConns: 1,
+		},
+		{
+			name: "success: chunked responses keep connection framed",
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				for i := 0; i < 3; i++ {
+					assert.Equal(t, "chunk-1chunk-2", readAll(t, get(t, c, baseURL+"/chunked")))
+				}
+			},
+			wantConns: 1,
+		},
+		{
+			name: "success: half-read body evicts connection",
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				resp := get(t, c, baseURL+"/chunked")
+				buf := make([]byte, 3)
+				_, err := io.ReadFull(resp.Body, buf)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+			},
+			wantConns: 2,
+		},
+		{
+			name: "success: server closes connection",
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				assert.Equal(t, "bye", readAll(t, get(t, c, baseURL+"/close")))
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+			},
+			wantConns: 2,
+		},
+		{
+			name: "success: idle connection expires",
+			opts: []Option{WithIdleConnTimeout(50 * time.Millisecond)},
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+				time.Sleep(150 * time.Millisecond)
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+			},
+			wantConns: 2,
+		},
+		{
+			name: "success: keep-alive disabled",
+			opts: []Option{WithMaxIdleConnsPerHost(0)},
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+				assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+			},
+			wantConns: 2,
+		},
+		{
+			name: "success: concurrent requests respect max conns per host",
+			opts: []Option{WithMaxConnsPerHost(1)},
+			do: func(t *testing.T, c HTTPClient, baseURL string) {
+				var wg sync.WaitGroup
+				for i := 0; i < 5; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						assert.Equal(t, "hello", readAll(t, get(t, c, baseURL+"/hello")))
+					}()
+				}
+				wg.Wait()
+			},
+			wantConns: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("hello"))
+			})
+			mux.HandleFunc("/chunked", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("chunk-1"))
+				w.(http.Flusher).Flush()
+				_, _ = w.Write([]byte("chunk-2"))
+			})
+			mux.HandleFunc("/close", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Connection", "close")
+				_, _ = w.Write([]byte("bye"))
+			})
+
+			var conns atomic.Int32
+			srv := httptest.NewUnstartedServer(mux)
+			srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					conns.Add(1)
+				}
+			}
+			srv.Start()
+			defer srv.Close()
+
+			c := New(tt.opts...)
+			tt.do(t, c, srv.URL)
+			assert.Equal(t, int32(tt.wantConns), conns.Load())
+		})
+	}
+}
+
+func Test_myClient_Do_Redirect(t *testing.T) {
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = fmt.Fprintf(w, "%s %s|auth=%s|ct=%s", r.Method, body, r.Header.Get("Authorization"), r.Header.Get("Content-Type"))
+	}
+	other := httptest.NewServer(http.HandlerFunc(echo))
+	defer other.Close()
+	otherURL, err := url.Parse(other.URL)
+	require.NoError(t, err)
+	// тот же сервер, но под другим именем хоста
+	crossHost := "http://localhost:" + otherURL.Port()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", echo)
+	mux.HandleFunc("/referer", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Referer())
+	})
+	for _, code := range []int{301, 302, 303, 307, 308} {
+		mux.HandleFunc(fmt.Sprintf("/%d", code), func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/echo", code)
+		})
+	}
+	mux.HandleFunc("/chain/", func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		_, _ = fmt.Sscanf(r.URL.Path, "/chain/%d", &n)
+		if n == 0 {
+			http.Redirect(w, r, "/echo", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/chain/%d", n-1), http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, crossHost+"/echo", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/to-referer", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/referer", http.StatusFound)
+	})
+	mux.HandleFunc("/no-location", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		newReq   func(t *testing.T) *http.Request
+		wantCode int
+		wantPath string // путь последнего запроса, resp.Request
+		wantBody string
+		wantErr  string
+	}{
+		{
+			name: "success: 303 turns POST into GET without body",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodPost, srv.URL+"/303", strings.NewReader("payload"))
+				require.NoError(t, err)
+				req.Header.Set("Content-Type", "text/plain")
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/echo",
+			wantBody: "GET |auth=|ct=",
+		},
+		{
+			name: "success: 301 keeps GET",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/301", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/echo",
+			wantBody: "GET |auth=|ct=",
+		},
+		{
+			name: "success: 307 replays method and body",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodPut, srv.URL+"/307", strings.NewReader("payload"))
+				require.NoError(t, err)
+				req.Header.Set("Content-Type", "text/plain")
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/echo",
+			wantBody: "PUT payload|auth=|ct=text/plain",
+		},
+		{
+			name: "success: 308 with non-rewindable body is returned as is",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodPost, srv.URL+"/308", io.NopCloser(strings.NewReader("payload")))
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusPermanentRedirect,
+			wantPath: "/308",
+		},
+		{
+			name: "success: same host keeps Authorization",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/chain/2", nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer secret")
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/echo",
+			wantBody: "GET |auth=Bearer secret|ct=",
+		},
+		{
+			name: "success: cross-host hop strips Authorization",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/away", nil)
+				require.NoError(t, err)
+				req.Header.Set("Authorization", "Bearer secret")
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/echo",
+			wantBody: "GET |auth=|ct=",
+		},
+		{
+			name: "success: Referer points to previous hop",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/to-referer", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusOK,
+			wantPath: "/referer",
+			wantBody: srv.URL + "/to-referer",
+		},
+		{
+			name: "success: 3xx without Location is returned as is",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/no-location", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusFound,
+			wantPath: "/no-location",
+		},
+		{
+			name: "success: ErrUseLastResponse stops on first redirect",
+			opts: []Option{WithCheckRedirect(func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			})},
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/chain/1", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusFound,
+			wantPath: "/chain/1",
+			wantBody: "<a href=\"/chain/0\">Found</a>.\n\n",
+		},
+		{
+			name: "error: default policy stops after 10 redirects",
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/chain/20", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusFound,
+			wantPath: "/chain/11",
+			wantErr:  "stopped after 10 redirects",
+		},
+		{
+			name: "error: custom policy sees the redirect chain",
+			opts: []Option{WithCheckRedirect(func(req *http.Request, via []*http.Request) error {
+				if len(via) >= 2 {
+					return fmt.Errorf("too far from %s: %s", via[0].URL.Path, req.URL.Path)
+				}
+				return nil
+			})},
+			newReq: func(t *testing.T) *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/chain/5", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusFound,
+			wantPath: "/chain/4",
+			wantErr:  "too far from /chain/5: /chain/3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := New(tt.opts...).Do(tt.newReq(t))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NotNil(t, resp)
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+			require.NotNil(t, resp.Request)
+			assert.Equal(t, tt.wantPath, resp.Request.URL.Path)
+			if tt.wantErr != "" {
+				return
+			}
+
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+		})
+	}
+}
+
+func Test_myClient_Do_CookieJar(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		http.SetCookie(w, &http.Cookie{Name: "admin", Value: "a1", Path: "/admin"})
+		http.Redirect(w, r, "/whoami", http.StatusFound)
+	})
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Path: "/", MaxAge: -1})
+	})
+	whoami := func(w http.ResponseWriter, r *http.Request) {
+		var names []string
+		for _, c := range r.Cookies() {
+			names = append(names, c.Name+"="+c.Value)
+		}
+		slices.Sort(names)
+		_, _ = io.WriteString(w, strings.Join(names, ";"))
+	}
+	mux.HandleFunc("/whoami", whoami)
+	mux.HandleFunc("/admin/whoami", whoami)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	get := func(t *testing.T, c HTTPClient, path string) string {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	t.Run("success: cookiejar applies domain, path and expiry rules", func(t *testing.T) {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		c := New(WithCookieJar(jar))
+
+		// cookie из ответа-редиректа уже уходят со следующим запросом
+		assert.Equal(t, "session=s1", get(t, c, "/login"))
+		assert.Equal(t, "admin=a1;session=s1", get(t, c, "/admin/whoami"))
+
+		// под другим именем хоста cookie не отправляются
+		other := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+		req, err := http.NewRequest(http.MethodGet, other+"/whoami", nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Empty(t, string(body))
+
+		get(t, c, "/logout")
+		assert.Equal(t, "admin=a1", get(t, c, "/admin/whoami"))
+	})
+
+	t.Run("success: custom jar sees every hop", func(t *testing.T) {
+		jar := &memJar{cookies: []*http.Cookie{{Name: "preset", Value: "p"}}}
+		c := New(WithCookieJar(jar))
+
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/login", nil)
+		require.NoError(t, err)
+		req.Header.Set("Cookie", "own=o")
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, "own=o;preset=p", string(body))
+		assert.Equal(t, []string{"/login", "/whoami"}, jar.asked)
+		assert.Equal(t, []string{"/login"}, jar.stored)
+		// заголовки вызывающего не меняются
+		assert.Equal(t, "own=o", req.Header.Get("Cookie"))
+	})
+}
+
+// memJar - простейший jar: всегда отдает одни и те же cookie и запоминает, куда его спрашивали
+type memJar struct {
+	mu      sync.Mutex
+	cookies []*http.Cookie
+	asked   []string
+	stored  []string
+}
+
+func (j *memJar) SetCookies(u *url.URL, _ []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stored = append(j.stored, u.Path)
+}
+
+func (j *memJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.asked = append(j.asked, u.Path)
+	return j.cookies
+}
+
+func Test_myClient_Do_Context(t *testing.T) {
+	// serverGone закрывается, когда сервер замечает, что клиент оборвал соединение
+	var serverGone chan struct{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hang", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(serverGone)
+	})
+	mux.HandleFunc("/partial", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "first part")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(serverGone)
+	})
+	mux.HandleFunc("/fast", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "fast")
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		opts        []Option
+		path        string
+		ctx         func() (context.Context, context.CancelFunc)
+		wantDoErr   error
+		wantReadErr error
+		wantTimeout bool
+	}{
+		{
+			name: "error: context cancelled before sending",
+			path: "/fast",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				return ctx, cancel
+			},
+			wantDoErr: context.Canceled,
+		},
+		{
+			name: "error: context cancelled while waiting for headers",
+			path: "/hang",
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(50*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			wantDoErr: context.Canceled,
+		},
+		{
+			name: "error: deadline exceeded while reading body",
+			path: "/partial",
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			wantReadErr: context.DeadlineExceeded,
+		},
+		{
+			name:        "error: client timeout while waiting for headers",
+			opts:        []Option{WithTimeout(50 * time.Millisecond)},
+			path:        "/hang",
+			wantDoErr:   context.DeadlineExceeded,
+			wantTimeout: true,
+		},
+		{
+			name:        "error: client timeout covers body read",
+			opts:        []Option{WithTimeout(100 * time.Millisecond)},
+			path:        "/partial",
+			wantReadErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverGone = make(chan struct{})
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if tt.ctx != nil {
+				ctx, cancel = tt.ctx()
+			}
+			defer cancel()
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+tt.path, nil)
+			require.NoError(t, err)
+			start := time.Now()
+			resp, err := New(tt.opts...).Do(req)
+			if tt.wantDoErr != nil {
+				require.Error(t, err)
+				assert.ErrorIs(t, err, tt.wantDoErr)
+				var urlErr *url.Error
+				require.ErrorAs(t, err, &urlErr)
+				assert.Equal(t, "Get", urlErr.Op)
+				assert.Equal(t, tt.wantTimeout, urlErr.Timeout())
+			} else {
+				require.NoError(t, err)
+				defer resp.Body.Close()
+				_, err = io.ReadAll(resp.Body)
+				assert.ErrorIs(t, err, tt.wantReadErr)
+			}
+			assert.Less(t, time.Since(start), 2*time.Second)
+
+			if tt.path != "/fast" {
+				// соединение закрыто, и сервер это видит
+				select {
+				case <-serverGone:
+				case <-time.After(2 * time.Second):
+					t.Fatal("server did not notice the closed connection")
+				}
+			}
+		})
+	}
+
+	t.Run("success: client timeout is lifted once body is read", func(t *testing.T) {
+		c := New(WithTimeout(100 * time.Millisecond))
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/fast", nil)
+		require.NoError(t, err)
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "fast", string(body))
+
+		// соединение вернулось в пул и не закрылось по таймауту
+		time.Sleep(150 * time.Millisecond)
+		resp, err = c.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	})
+
+	t.Run("error: context cancelled while waiting for a free connection", func(t *testing.T) {
+		serverGone = make(chan struct{})
+		c := New(WithMaxConnsPerHost(1))
+		busyCtx, stopBusy := context.WithCancel(context.Background())
+		defer stopBusy()
+		busy, err := http.NewRequestWithContext(busyCtx, http.MethodGet, srv.URL+"/hang", nil)
+		require.NoError(t, err)
+		go func() {
+			_, _ = c.Do(busy)
+		}()
+		time.Sleep(50 * time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/fast", nil)
+		require.NoError(t, err)
+		_, err = c.Do(req)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func Test_Transport_RoundTrip(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		http.Redirect(w, r, "/echo", http.StatusFound)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		cookie, _ := r.Cookie("session")
+		_, _ = fmt.Fprintf(w, "%s %s cookie=%v", r.Method, body, cookie)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	t.Run("success: transport itself does not follow redirects", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/redirect", nil)
+		require.NoError(t, err)
+		resp, err := NewTransport().RoundTrip(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		assert.Equal(t, "/echo", resp.Header.Get("Location"))
+	})
+
+	t.Run("success: http.Client on top handles redirects and cookies", func(t *testing.T) {
+		jar, err := cookiejar.New(nil)
+		require.NoError(t, err)
+		tr := NewTransport()
+		c := &http.Client{Transport: tr, Jar: jar, Timeout: 5 * time.Second}
+		defer c.CloseIdleConnections()
+
+		resp, err := c.Get(srv.URL + "/redirect")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "GET  cookie=session=s1", string(body))
+		assert.Equal(t, "/echo", resp.Request.URL.Path)
+
+		resp, err = c.Post(srv.URL+"/echo", "text/plain", strings.NewReader("payload"))
+		require.NoError(t, err)
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "POST payload cookie=session=s1", string(body))
+	})
+
+	t.Run("error: request body is closed on failure", func(t *testing.T) {
+		port, err := freeport.GetFreePort()
+		require.NoError(t, err)
+		body := &closeTrackingBody{Reader: strings.NewReader("payload")}
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://localhost:%d/", port), body)
+		require.NoError(t, err)
+
+		_, err = NewTransport().RoundTrip(req)
+		assert.Error(t, err)
+		assert.True(t, body.closed.Load())
+	})
+}
+
+type closeTrackingBody struct {
+	io.Reader
+	closed atomic.Bool
+}
+
+func (b *closeTrackingBody) Close() error {
+	b.closed.Store(true)
+	return nil
+}
+
+func Test_myClient_Do_Proxy(t *testing.T) {
+	origin := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s proxy-auth=%q", r.Method, r.URL.Path, r.Header.Get("Proxy-Authorization"))
+	}
+	plain := httptest.NewServer(http.HandlerFunc(origin))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.HandlerFunc(origin))
+	defer secure.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(secure.Certificate())
+
+	proxy := newTestProxy(t, "user:secret")
+
+	tests := []struct {
+		name       string
+		target     string
+		proxyUser  *url.Userinfo
+		direct     bool // функция выбора прокси возвращает nil
+		wantStatus int
+		wantBody   string
+		wantSeen   []string // строки запроса, которые увидел прокси
+		wantErr    string
+	}{
+		{
+			name:       "success: plain http uses absolute-form target",
+			target:     plain.URL + "/hello",
+			proxyUser:  url.UserPassword("user", "secret"),
+			wantStatus: http.StatusOK,
+			wantBody:   `GET /hello proxy-auth=""`,
+			wantSeen:   []string{"GET " + plain.URL + "/hello"},
+		},
+		{
+			name:       "success: https goes through CONNECT tunnel",
+			target:     secure.URL + "/hello",
+			proxyUser:  url.UserPassword("user", "secret"),
+			wantStatus: http.StatusOK,
+			wantBody:   `GET /hello proxy-auth=""`,
+			wantSeen:   []string{"CONNECT " + strings.TrimPrefix(secure.URL, "https://")},
+		},
+		{
+			name:       "success: nil proxy URL means direct connection",
+			target:     plain.URL + "/hello",
+			direct:     true,
+			wantStatus: http.StatusOK,
+			wantBody:   `GET /hello proxy-auth=""`,
+		},
+		{
+			name:       "error: plain http with wrong credentials gets 407",
+			target:     plain.URL + "/hello",
+			proxyUser:  url.UserPassword("user", "wrong"),
+			wantStatus: http.StatusProxyAuthRequired,
+			wantSeen:   []string{"GET " + plain.URL + "/hello"},
+		},
+		{
+			name:     "error: CONNECT without credentials is refused",
+			target:   secure.URL + "/hello",
+			wantErr:  "proxy refused CONNECT",
+			wantSeen: []string{"CONNECT " + strings.TrimPrefix(secure.URL, "https://")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy.reset()
+			proxyURL := &url.URL{Scheme: "http", Host: proxy.addr, User: tt.proxyUser}
+			c := New(
+				WithTLSConfig(&tls.Config{RootCAs: roots}),
+				WithProxy(func(*http.Request) (*url.URL, error) {
+					if tt.direct {
+						return nil, nil
+					}
+					return proxyURL, nil
+				}),
+			)
+
+			req, err := http.NewRequest(http.MethodGet, tt.target, nil)
+			require.NoError(t, err)
+			resp, err := c.Do(req)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				assert.Equal(t, tt.wantSeen, proxy.seen())
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(body))
+			}
+			assert.Equal(t, tt.wantSeen, proxy.seen())
+			assert.Empty(t, req.Header.Get("Proxy-Authorization"))
+		})
+	}
+}
+
+// testProxy - прокси на myhttp сервере: пересылает обычные запросы через myhttp Transport
+// и поднимает туннели для CONNECT через Hijack
+type testProxy struct {
+	addr string
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func newTestProxy(t *testing.T, userinfo string) *testProxy {
+	t.Helper()
+
+	p := &testProxy{}
+	wantAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte(userinfo))
+	upstream := NewTransport()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.lines = append(p.lines, r.Method+" "+r.RequestURI)
+		p.mu.Unlock()
+
+		if r.Header.Get("Proxy-Authorization") != wantAuth {
+			w.Header().Set("Proxy-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method == http.MethodConnect {
+			dst, err := net.Dial("tcp", r.Host)
+			if err != nil {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				_ = dst.Close()
+				return
+			}
+			_, _ = buf.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+			_ = buf.Flush()
+			go func() {
+				_, _ = io.Copy(dst, buf)
+				_ = dst.Close()
+			}()
+			go func() {
+				_, _ = io.Copy(conn, dst)
+				_ = conn.Close()
+			}()
+			return
+		}
+
+		out := r.Clone(r.Context())
+		out.RequestURI = ""
+		out.Header.Del("Proxy-Authorization")
+		resp, err := upstream.RoundTrip(out)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		for k, v := range resp.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	})
+
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+	p.addr = fmt.Sprintf("localhost:%d", port)
+	srv := server.New()
+	go func() {
+		_ = srv.ListenAndServe(p.addr, handler)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+	// ждём пока прокси поднимется
+	time.Sleep(100 * time.Millisecond)
+	return p
+}
+
+func (p *testProxy) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lines = nil
+}
+
+func (p *testProxy) seen() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.lines)
+}
+
+func Test_myClient_Do_Decompression(t *testing.T) {
+	const payload = `{"greeting": "Hello, World!"}`
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Accept-Encoding", r.Header.Get("Accept-Encoding"))
+		encoding := r.URL.Query().Get("encoding")
+		if encoding == "" || !strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+			_, _ = io.WriteString(w, payload)
+			return
+		}
+		w.Header().Set("Content-Encoding", encoding)
+		enc, err := convert.NewEncoder(w, encoding)
+		require.NoError(t, err)
+		_, _ = io.WriteString(enc, payload)
+		_ = enc.Close()
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	tests := []struct {
+		name             string
+		opts             []Option
+		query            string
+		acceptEncoding   string
+		wantSent         string
+		wantEncoding     string
+		wantUncompressed bool
+		wantBody         string
+	}{
+		{
+			name:             "success: gzip is decompressed transparently",
+			query:            "?encoding=gzip",
+			wantSent:         "gzip, deflate",
+			wantUncompressed: true,
+			wantBody:         payload,
+		},
+		{
+			name:             "success: deflate is decompressed transparently",
+			query:            "?encoding=deflate",
+			wantSent:         "gzip, deflate",
+			wantUncompressed: true,
+			wantBody:         payload,
+		},
+		{
+			name:     "success: uncompressed response is passed as is",
+			wantSent: "gzip, deflate",
+			wantBody: payload,
+		},
+		{
+			name:           "success: caller's Accept-Encoding disables decompression",
+			query:          "?encoding=gzip",
+			acceptEncoding: "gzip",
+			wantSent:       "gzip",
+			wantEncoding:   "gzip",
+		},
+		{
+			name:     "success: compression disabled",
+			opts:     []Option{WithDisableCompression()},
+			query:    "?encoding=gzip",
+			wantBody: payload,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns.Store(0)
+			c := New(tt.opts...)
+			for i := 0; i < 2; i++ {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+tt.query, nil)
+				require.NoError(t, err)
+				if tt.acceptEncoding != "" {
+					req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+				}
+				resp, err := c.Do(req)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+
+				assert.Equal(t, tt.wantSent, resp.Header.Get("X-Accept-Encoding"))
+				assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+				assert.Equal(t, tt.wantUncompressed, resp.Uncompressed)
+				if tt.wantUncompressed {
+					assert.Equal(t, int64(-1), resp.ContentLength)
+					assert.Empty(t, resp.Header.Get("Content-Length"))
+				}
+				if tt.wantBody != "" {
+					assert.Equal(t, tt.wantBody, string(body))
+				}
+			}
+			// распакованное до конца тело возвращает соединение в пул
+			assert.Equal(t, int32(1), conns.Load())
+		})
+	}
+}
+
+func Test_myClient_Do_Trailers(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Echo-Checksum")
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+		w.Header().Set("X-Echo-Checksum", r.Trailer.Get("X-Checksum"))
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	c := New(WithDisableCompression())
+	for i := 0; i < 2; i++ {
+		req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("hello"))
+		require.NoError(t, err)
+		req.Trailer = http.Header{"X-Checksum": {"abc"}}
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		// до конца тела известны только объявленные ключи
+		assert.Equal(t, http.Header{"X-Echo-Checksum": nil}, resp.Trailer)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		assert.Equal(t, "hello", string(body))
+		assert.Equal(t, http.Header{"X-Echo-Checksum": {"abc"}, "Grpc-Status": {"0"}}, resp.Trailer)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func Test_myClient_Do_ExpectContinue(t *testing.T) {
+	// обычный сервер: 100 Continue уходит, когда обработчик начинает читать тело
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	// сервер, который не знает про Expect и молча ждет тело
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := convert.ParseRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				body, _ := io.ReadAll(req.Body)
+				_ = convert.WriteResponse(conn, &http.Response{
+					StatusCode: http.StatusOK,
+					Header:     http.Header{"Connection": {"close"}},
+					Body:       io.NopCloser(bytes.NewReader(body)),
+				})
+			}()
+		}
+	}()
+
+	tests := []struct {
+		name        string
+		url         string
+		opts        []Option
+		auth        bool
+		wantStatus  int
+		wantBody    string
+		wantSent    bool
+		minDuration time.Duration
+		maxDuration time.Duration
+	}{
+		{
+			name:        "success: body is sent after 100 Continue",
+			url:         srv.URL,
+			opts:        []Option{WithExpectContinueTimeout(5 * time.Second)},
+			auth:        true,
+			wantStatus:  http.StatusOK,
+			wantBody:    "hello",
+			wantSent:    true,
+			maxDuration: 2 * time.Second,
+		},
+		{
+			name:        "success: body is not sent after final status",
+			url:         srv.URL,
+			opts:        []Option{WithExpectContinueTimeout(5 * time.Second)},
+			wantStatus:  http.StatusUnauthorized,
+			maxDuration: 2 * time.Second,
+		},
+		{
+			name:        "success: body is sent after timeout",
+			url:         "http://" + l.Addr().String(),
+			opts:        []Option{WithExpectContinueTimeout(200 * time.Millisecond)},
+			wantStatus:  http.StatusOK,
+			wantBody:    "hello",
+			wantSent:    true,
+			minDuration: 200 * time.Millisecond,
+			maxDuration: 2 * time.Second,
+		},
+		{
+			name:        "success: zero timeout sends body at once",
+			url:         "http://" + l.Addr().String(),
+			opts:        []Option{WithExpectContinueTimeout(0)},
+			wantStatus:  http.StatusOK,
+			wantBody:    "hello",
+			wantSent:    true,
+			maxDuration: 150 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(tt.opts...)
+			body := &readTrackingBody{Reader: strings.NewReader("hello")}
+			req, err := http.NewRequest(http.MethodPost, tt.url, body)
+			require.NoError(t, err)
+			req.ContentLength = 5
+			req.Header.Set("Expect", "100-continue")
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer token")
+			}
+
+			start := time.Now()
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			elapsed := time.Since(start)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(got))
+			assert.Equal(t, tt.wantSent, body.read.Load())
+			assert.GreaterOrEqual(t, elapsed, tt.minDuration)
+			assert.Less(t, elapsed, tt.maxDuration)
+		})
+	}
+}
+
+type readTrackingBody struct {
+	io.Reader
+	read atomic.Bool
+}
+
+func (b *readTrackingBody) Read(p []byte) (int, error) {
+	b.read.Store(true)
+	return b.Reader.Read(p)
+}
+
+func Test_NewMultipartBody(t *testing.T) {
+	const fileSize = 8 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// части читаем потоком, чтобы проверить, что тело не нужно собирать целиком
+		var parts []string
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			n, _ := io.Copy(io.Discard, part)
+			parts = append(parts, fmt.Sprintf("%s:%s:%d", part.FormName(), part.FileName(), n))
+		}
+		_, _ = fmt.Fprintf(w, "%d %s", r.ContentLength, strings.Join(parts, ","))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		write    func(mw *multipart.Writer) error
+		wantBody string
+		wantErr  bool
+	}{
+		{
+			name: "success: fields and large file are streamed",
+			write: func(mw *multipart.Writer) error {
+				if err := mw.WriteField("name", "gopher"); err != nil {
+					return err
+				}
+				part, err := mw.CreateFormFile("file", "data.bin")
+				if err != nil {
+					return err
+				}
+				_, err = io.Copy(part, io.LimitReader(zeroReader{}, fileSize))
+				return err
+			},
+			wantBody: fmt.Sprintf("-1 name::6,file:data.bin:%d", fileSize),
+		},
+		{
+			name: "error: writer failure aborts the request",
+			write: func(mw *multipart.Writer) error {
+				return errors.New("source is gone")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, contentType := NewMultipartBody(tt.write)
+			req, err := http.NewRequest(http.MethodPost, srv.URL, body)
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", contentType)
+
+			resp, err := New().Do(req)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(got))
+		})
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func Test_myClient_Do_Trace(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(secure.Certificate())
+	// через localhost, а не 127.0.0.1, чтобы клиенту пришлось резолвить имя
+	plainURL := strings.Replace(plain.URL, "127.0.0.1", "localhost", 1)
+
+	c := New(WithTLSConfig(&tls.Config{RootCAs: roots}))
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		header     http.Header
+		body       string
+		anyOrder   bool // запись тела и чтение ответа идут параллельно
+		wantEvents []string
+	}{
+		{
+			name:   "success: new connection",
+			method: http.MethodGet,
+			url:    plainURL,
+			wantEvents: []string{
+				"GetConn", "DNSStart", "DNSDone", "ConnectStart", "ConnectDone", "GotConn reused=false",
+				"WroteHeaders", "WroteRequest err=<nil>", "GotFirstResponseByte", "PutIdleConn err=<nil>",
+			},
+		},
+		{
+			name:   "success: reused connection",
+			method: http.MethodGet,
+			url:    plainURL,
+			wantEvents: []string{
+				"GetConn", "GotConn reused=true",
+				"WroteHeaders", "WroteRequest err=<nil>", "GotFirstResponseByte", "PutIdleConn err=<nil>",
+			},
+		},
+		{
+			name:   "success: tls handshake",
+			method: http.MethodGet,
+			url:    secure.URL,
+			wantEvents: []string{
+				"GetConn", "ConnectStart", "ConnectDone", "TLSHandshakeStart", "TLSHandshakeDone err=<nil>",
+				"GotConn reused=false", "WroteHeaders", "WroteRequest err=<nil>", "GotFirstResponseByte",
+				"PutIdleConn err=<nil>",
+			},
+		},
+		{
+			name:     "success: expect continue",
+			method:   http.MethodPost,
+			url:      plainURL,
+			header:   http.Header{"Expect": {"100-continue"}},
+			body:     "payload",
+			anyOrder: true,
+			wantEvents: []string{
+				"GetConn", "GotConn reused=true", "WroteHeaders", "Wait100Continue", "GotFirstResponseByte",
+				"Got100Continue", "Got1xxResponse 100", "WroteRequest err=<nil>", "PutIdleConn err=<nil>",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				events []string
+			)
+			record := func(format string, args ...any) {
+				mu.Lock()
+				defer mu.Unlock()
+				event := fmt.Sprintf(format, args...)
+				// при подключении к localhost dialer может попробовать несколько адресов
+				if len(events) == 0 || events[len(events)-1] != event {
+					events = append(events, event)
+				}
+			}
+			trace := &httptrace.ClientTrace{
+				GetConn:              func(string) { record("GetConn") },
+				DNSStart:             func(httptrace.DNSStartInfo) { record("DNSStart") },
+				DNSDone:              func(httptrace.DNSDoneInfo) { record("DNSDone") },
+				ConnectStart:         func(string, string) { record("ConnectStart") },
+				ConnectDone:          func(string, string, error) { record("ConnectDone") },
+				TLSHandshakeStart:    func() { record("TLSHandshakeStart") },
+				TLSHandshakeDone:     func(_ tls.ConnectionState, err error) { record("TLSHandshakeDone err=%v", err) },
+				GotConn:              func(info httptrace.GotConnInfo) { record("GotConn reused=%v", info.Reused) },
+				WroteHeaders:         func() { record("WroteHeaders") },
+				Wait100Continue:      func() { record("Wait100Continue") },
+				WroteRequest:         func(info httptrace.WroteRequestInfo) { record("WroteRequest err=%v", info.Err) },
+				GotFirstResponseByte: func() { record("GotFirstResponseByte") },
+				Got100Continue:       func() { record("Got100Continue") },
+				Got1xxResponse: func(code int, _ textproto.MIMEHeader) error {
+					record("Got1xxResponse %d", code)
+					return nil
+				},
+				PutIdleConn: func(err error) { record("PutIdleConn err=%v", err) },
+			}
+
+			ctx := httptrace.WithClientTrace(context.Background(), trace)
+			req, err := http.NewRequestWithContext(ctx, tt.method, tt.url, strings.NewReader(tt.body))
+			require.NoError(t, err)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.body, string(body))
+
+			mu.Lock()
+			defer mu.Unlock()
+			if tt.anyOrder {
+				assert.ElementsMatch(t, tt.wantEvents, events)
+			} else {
+				assert.Equal(t, tt.wantEvents, events)
+			}
+		})
+	}
+}
+
+func Test_myClient_Do_TraceGot1xxError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_, _ = http.ReadRequest(bufio.NewReader(conn))
+		_, _ = io.WriteString(conn, "HTTP/1.1 103 Early Hints\r\nLink: </style.css>\r\n\r\nHTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+	}()
+
+	errStop := errors.New("stop")
+	var gotLink string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			gotLink = header.Get("Link")
+			return errStop
+		},
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+l.Addr().String(), nil)
+	require.NoError(t, err)
+
+	_, err = New().Do(req)
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, "</style.css>", gotLink)
+}
+
+func Test_myClient_Do_Retry(t *testing.T) {
+	// failFirst отвечает code на первые n попыток, а потом 200 с телом запроса
+	failFirst := func(n, code int, header http.Header) func(attempt int, w http.ResponseWriter, r *http.Request) {
+		return func(attempt int, w http.ResponseWriter, r *http.Request) {
+			if attempt <= n {
+				maps.Copy(w.Header(), header)
+				w.WriteHeader(code)
+				_, _ = io.WriteString(w, "try later")
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "ok %s", body)
+		}
+	}
+	fast := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		method       string
+		header       http.Header
+		body         string
+		handler      func(attempt int, w http.ResponseWriter, r *http.Request)
+		wantStatus   int
+		wantBody     string
+		wantAttempts int
+	}{
+		{
+			name:         "success: no policy means no retries",
+			method:       http.MethodGet,
+			handler:      failFirst(1, http.StatusServiceUnavailable, nil),
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     "try later",
+			wantAttempts: 1,
+		},
+		{
+			name:         "success: get retried until success",
+			opts:         []Option{WithRetry(fast)},
+			method:       http.MethodGet,
+			handler:      failFirst(2, http.StatusBadGateway, nil),
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok ",
+			wantAttempts: 3,
+		},
+		{
+			name:         "success: last response returned when attempts run out",
+			opts:         []Option{WithRetry(fast)},
+			method:       http.MethodGet,
+			handler:      failFirst(5, http.StatusGatewayTimeout, nil),
+			wantStatus:   http.StatusGatewayTimeout,
+			wantBody:     "try later",
+			wantAttempts: 3,
+		},
+		{
+			name:         "success: post is not retried",
+			opts:         []Option{WithRetry(fast)},
+			method:       http.MethodPost,
+			body:         "payload",
+			handler:      failFirst(1, http.StatusServiceUnavailable, nil),
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     "try later",
+			wantAttempts: 1,
+		},
+		{
+			name:         "success: post with idempotency key replays body",
+			opts:         []Option{WithRetry(fast)},
+			method:       http.MethodPost,
+			header:       http.Header{"Idempotency-Key": {"order-1"}},
+			body:         "payload",
+			handler:      failFirst(1, http.StatusServiceUnavailable, nil),
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok payload",
+			wantAttempts: 2,
+		},
+		{
+			name:         "success: status outside policy is not retried",
+			opts:         []Option{WithRetry(RetryPolicy{MaxAttempts: 3, Statuses: []int{http.StatusTooManyRequests}, BaseDelay: time.Millisecond})},
+			method:       http.MethodGet,
+			handler:      failFirst(1, http.StatusServiceUnavailable, nil),
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     "try later",
+			wantAttempts: 1,
+		},
+		{
+			name:         "success: custom status retried",
+			opts:         []Option{WithRetry(RetryPolicy{MaxAttempts: 3, Statuses: []int{http.StatusTooManyRequests}, BaseDelay: time.Millisecond})},
+			method:       http.MethodGet,
+			handler:      failFirst(1, http.StatusTooManyRequests, http.Header{"Retry-After": {"0"}}),
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok ",
+			wantAttempts: 2,
+		},
+		{
+			name:         "success: retry-after longer than max delay is returned",
+			opts:         []Option{WithRetry(RetryPolicy{MaxAttempts: 3, MaxDelay: 100 * time.Millisecond})},
+			method:       http.MethodGet,
+			handler:      failFirst(1, http.StatusServiceUnavailable, http.Header{"Retry-After": {"120"}}),
+			wantStatus:   http.StatusServiceUnavailable,
+			wantBody:     "try later",
+			wantAttempts: 1,
+		},
+		{
+			name:   "success: connection reset retried",
+			opts:   []Option{WithRetry(fast)},
+			method: http.MethodGet,
+			handler: func(attempt int, w http.ResponseWriter, r *http.Request) {
+				if attempt == 1 {
+					conn, _, err := http.NewResponseController(w).Hijack()
+					if err == nil {
+						_ = conn.Close()
+					}
+					return
+				}
+				_, _ = io.WriteString(w, "ok")
+			},
+			wantStatus:   http.StatusOK,
+			wantBody:     "ok",
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.handler(int(hits.Add(1)), w, r)
+			}))
+			defer srv.Close()
+
+			var body io.Reader
+			if tt.body != "" {
+				body = strings.NewReader(tt.body)
+			}
+			req, err := http.NewRequest(tt.method, srv.URL+"/", body)
+			require.NoError(t, err)
+			maps.Copy(req.Header, tt.header)
+
+			resp, err := New(tt.opts...).Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(got))
+			assert.Equal(t, tt.wantAttempts, Attempts(resp))
+			assert.EqualValues(t, tt.wantAttempts, hits.Load())
+		})
+	}
+
+	t.Run("error: attempts reported for connection errors", func(t *testing.T) {
+		port, err := freeport.GetFreePort()
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://localhost:%d/", port), nil)
+		require.NoError(t, err)
+
+		_, err = New(WithRetry(fast)).Do(req)
+		var retryErr *RetryError
+		require.ErrorAs(t, err, &retryErr)
+		assert.Equal(t, 3, retryErr.Attempts)
+		assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+	})
+
+	t.Run("error: context expires during backoff", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		defer srv.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+
+		start := time.Now()
+		_, err = New(WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: 5 * time.Second})).Do(req)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+}
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		attempt  int
+		wantFrom time.Duration
+		wantTo   time.Duration
+	}{
+		{attempt: 1, wantFrom: 50 * time.Millisecond, wantTo: 100 * time.Millisecond},
+		{attempt: 2, wantFrom: 100 * time.Millisecond, wantTo: 200 * time.Millisecond},
+		{attempt: 3, wantFrom: 200 * time.Millisecond, wantTo: 400 * time.Millisecond},
+		{attempt: 5, wantFrom: 500 * time.Millisecond, wantTo: time.Second},
+		{attempt: 100, wantFrom: 500 * time.Millisecond, wantTo: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("attempt %d", tt.attempt), func(t *testing.T) {
+			for range 20 {
+				d := p.backoff(tt.attempt)
+				assert.GreaterOrEqual(t, d, tt.wantFrom)
+				assert.LessOrEqual(t, d, tt.wantTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"io"
+	"mime/multipart"
+	"sync"
+)
+
+// NewMultipartBody возвращает тело запроса multipart/form-data и его Content-Type. Части пишет
+// write, причем по мере отправки запроса: тело не собирается в памяти целиком, поэтому так можно
+// загружать файлы любого размера. Длина тела заранее неизвестна, и клиент отправляет его чанками.
+// write вызывается в отдельной горутине при первом чтении тела; его ошибка прерывает отправку.
+// Закрывающую границу NewMultipartBody дописывает сам.
+//
+//	body, contentType := client.NewMultipartBody(func(mw *multipart.Writer) error {
+//		part, err := mw.CreateFormFile("file", "dump.bin")
+//		if err != nil {
+//			return err
+//		}
+//		_, err = io.Copy(part, f)
+//		return err
+//	})
+//	req, _ := http.NewRequest(http.MethodPost, url, body)
+//	req.Header.Set("Content-Type", contentType)
+func NewMultipartBody(write func(mw *multipart.Writer) error) (body io.ReadCloser, contentType string) {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	return &multipartBody{pr: pr, pw: pw, mw: mw, write: write}, mw.FormDataContentType()
+}
+
+// multipartBody связывает писателя частей с отправкой запроса через io.Pipe
+type multipartBody struct {
+	pr    *io.PipeReader
+	pw    *io.PipeWriter
+	mw    *multipart.Writer
+	write func(mw *multipart.Writer) error
+	once  sync.Once
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	// горутина стартует только при отправке, иначе она навсегда зависла бы на записи в pipe
+	b.once.Do(func() {
+		go func() {
+			err := b.write(b.mw)
+			if err == nil {
+				err = b.mw.Close()
+			}
+			_ = b.pw.CloseWithError(err)
+		}()
+	})
+	return b.pr.Read(p)
+}
+
+// Close прерывает запись частей, если тело не дочитано
+func (b *multipartBody) Close() error {
+	return b.pr.Close()
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultMaxIdleConnsPerHost - сколько простаивающих соединений держим на один host:port
+	defaultMaxIdleConnsPerHost = 2
+	// defaultIdleConnTimeout - через сколько простаивающее соединение закрывается
+	defaultIdleConnTimeout = 90 * time.Second
+	// defaultExpectContinueTimeout - сколько тело запроса с Expect: 100-continue ждет ответа сервера
+	defaultExpectContinueTimeout = time.Second
+)
+
+// Option настраивает клиент, создаваемый через New
+type Option func(*options)
+
+type options struct {
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	maxConnsPerHost       int
+	tlsConfig             *tls.Config
+	checkRedirect         func(req *http.Request, via []*http.Request) error
+	jar                   http.CookieJar
+	timeout               time.Duration
+	proxy                 func(*http.Request) (*url.URL, error)
+	disableCompression    bool
+	expectContinueTimeout time.Duration
+	dialContext           func(ctx context.Context, network, addr string) (net.Conn, error)
+	retry                 RetryPolicy
+}
+
+func defaultOptions() options {
+	return options{
+		maxIdleConnsPerHost:   defaultMaxIdleConnsPerHost,
+		idleConnTimeout:       defaultIdleConnTimeout,
+		expectContinueTimeout: defaultExpectContinueTimeout,
+	}
+}
+
+// WithMaxIdleConnsPerHost задает, сколько простаивающих соединений хранить на один host:port.
+// 0 отключает переиспользование соединений.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(o *options) {
+		o.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout задает, сколько соединение может простаивать в пуле. 0 - без ограничения.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleConnTimeout = d
+	}
+}
+
+// WithMaxConnsPerHost ограничивает общее число соединений (активных и простаивающих) на один
+// host:port. Запросы сверх лимита ждут, пока соединение освободится. 0 - без ограничения.
+func WithMaxConnsPerHost(n int) Option {
+	return func(o *options) {
+		o.maxConnsPerHost = n
+	}
+}
+
+// WithTLSConfig задает настройки TLS для https-запросов: доверенные корневые сертификаты,
+// клиентский сертификат для mTLS и т.д. Если ServerName не задан, он берется из req.Host или URL.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithCheckRedirect задает политику редиректов, как http.Client.CheckRedirect: fn вызывается перед
+// каждым переходом с новым запросом и уже отправленными, самый первый - via[0].
+// Ошибка останавливает переход, и Do возвращает ее вместе с последним ответом (тело закрыто);
+// http.ErrUseLastResponse возвращает последний ответ без ошибки и с непрочитанным телом.
+// По умолчанию клиент проходит не больше 10 редиректов.
+func WithCheckRedirect(fn func(req *http.Request, via []*http.Request) error) Option {
+	return func(o *options) {
+		o.checkRedirect = fn
+	}
+}
+
+// WithCookieJar подключает хранилище cookie: клиент сохраняет в него Set-Cookie из всех ответов,
+// включая промежуточные редиректы, и добавляет подходящие cookie к каждому запросу.
+// Какие cookie подходят (домен, путь, Secure, срок жизни), решает jar, например net/http/cookiejar.
+func WithCookieJar(jar http.CookieJar) Option {
+	return func(o *options) {
+		o.jar = jar
+	}
+}
+
+// WithTimeout ограничивает общее время запроса: подключение, все редиректы и чтение тела ответа.
+// По истечении Do или чтение тела возвращают ошибку с Timeout() == true. 0 - без ограничения.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithProxy задает, через какой прокси отправлять запрос, например http.ProxyFromEnvironment.
+// Если fn возвращает nil, запрос идет напрямую. Поддерживаются прокси со схемами http и https:
+// http-запросы отправляются прокси с абсолютным URL, для https поднимается туннель через CONNECT.
+// Логин и пароль из URL прокси передаются в Proxy-Authorization.
+func WithProxy(fn func(*http.Request) (*url.URL, error)) Option {
+	return func(o *options) {
+		o.proxy = fn
+	}
+}
+
+// WithDisableCompression отключает прозрачное сжатие: клиент не добавляет Accept-Encoding
+// и отдает тело ответа как есть. Нужно, например, прокси, который пересылает ответ дальше.
+func WithDisableCompression() Option {
+	return func(o *options) {
+		o.disableCompression = true
+	}
+}
+
+// WithExpectContinueTimeout задает, сколько запрос с заголовком Expect: 100-continue ждет от сервера
+// 100 Continue или окончательного ответа, прежде чем все равно отправить тело. По умолчанию 1 секунда,
+// 0 - тело отправляется сразу, не дожидаясь сервера.
+func WithExpectContinueTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.expectContinueTimeout = d
+	}
+}
+
+// WithDialContext задает, как открывать соединения, вместо net.Dialer: например, через Unix-сокет
+// или listener в памяти. addr - host:port сервера или прокси; TLS, если нужен, поднимается поверх
+// возвращенного соединения.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(o *options) {
+		o.dialContext = dial
+	}
+}
+
+// WithRetry включает повтор запросов по policy. Повторяются только идемпотентные запросы (GET, HEAD,
+// PUT, DELETE и т.д.) и запросы с заголовком Idempotency-Key, у которых тело можно отправить заново
+// через GetBody - его заполняет http.NewRequest для bytes и strings. Поводы для повтора - сбой
+// соединения или ответ с кодом из policy.Statuses; между попытками клиент ждет с экспоненциальным
+// ростом паузы и случайным разбросом, а если ответ содержит Retry-After - столько, сколько просит
+// сервер. Сколько попыток понадобилось, сообщают Attempts и *RetryError.
+func WithRetry(policy RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = policy
+	}
+}
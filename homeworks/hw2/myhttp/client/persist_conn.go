@@ -0,0 +1,425 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
+)
+
+// aLongTimeAgo - дедлайн в прошлом, чтобы мгновенно прервать блокирующее чтение
+var aLongTimeAgo = time.Unix(1, 0)
+
+// persistConn - соединение с сервером, которое может обслужить несколько запросов подряд
+type persistConn struct {
+	t    *transport
+	key  connKey
+	conn net.Conn
+	br   *bufio.Reader
+	// proxyURL задан, если запросы идут через прокси без туннеля и пишутся в absolute-form
+	proxyURL *url.URL
+
+	reused bool       // соединение уже было в пуле
+	idle   bool       // лежит в пуле, защищено t.mu
+	idleAt time.Time  // когда соединение последний раз попало в пул
+	watch  chan error // результат watchIdle
+	once   sync.Once
+
+	// cancelErr - ошибка контекста, из-за которой соединение закрыли посреди запроса
+	cancelMu  sync.Mutex
+	cancelErr error
+}
+
+func newPersistConn(t *transport, key connKey, conn net.Conn) *persistConn {
+	return &persistConn{
+		t:    t,
+		key:  key,
+		conn: conn,
+		br:   bufio.NewReader(conn),
+	}
+}
+
+// roundTrip отправляет запрос и читает заголовки ответа. Пока запрос не завершен, включая чтение
+// тела, отмена req.Context() закрывает соединение, а все операции возвращают ошибку контекста.
+// С заголовком Expect: 100-continue тело отправляется только после 100 Continue от сервера или
+// по истечении WithExpectContinueTimeout; если сервер сразу ответил окончательно, тело не отправляется.
+// О ходе запроса сообщается в httptrace.ClientTrace из req.Context().
+func (pc *persistConn) roundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	trace := httptrace.ContextClientTrace(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		pc.cancel(ctx.Err())
+	})
+
+	wreq, requestedCompression := pc.transportRequest(req)
+	var gate *continueGate
+	if d := pc.t.opts.expectContinueTimeout; d > 0 && hasBody(req) && convert.HeaderHasToken(req.Header, "Expect", "100-continue") {
+		gate = newContinueGate(wreq.Body, d, trace)
+		r2 := *wreq
+		r2.Body = gate
+		wreq = &r2
+	}
+
+	writeErr := make(chan error, 1)
+	write := func() error {
+		err := pc.writeRequest(wreq)
+		if trace != nil && trace.WroteRequest != nil {
+			trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+		}
+		return err
+	}
+	if gate == nil {
+		if err := write(); err != nil {
+			stop()
+			return nil, requestWriteError{err: pc.mapErr(err)}
+		}
+		writeErr <- nil
+	} else {
+		// тело пишется параллельно с чтением ответа: ждать 100 Continue можно только так
+		go func() {
+			writeErr <- write()
+		}()
+	}
+	// writeDone ждет, пока запрос допишется, и сообщает, ушел ли он целиком
+	writeDone := func() error {
+		if gate != nil {
+			gate.open(false)
+		}
+		return <-writeErr
+	}
+
+	resp, err := pc.readResponse(gate, trace)
+	if err != nil {
+		stop()
+		if werr := writeDone(); werr != nil && !errors.Is(werr, errBodyNotSent) {
+			return nil, requestWriteError{err: pc.mapErr(werr)}
+		}
+		return nil, pc.mapErr(err)
+	}
+	resp.Request = req
+	if tlsConn, ok := pc.conn.(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		resp.TLS = &state
+	}
+
+	// у ответа на HEAD тела нет, даже если сервер прислал Content-Length
+	if req.Method == http.MethodHead {
+		resp.Body = http.NoBody
+	}
+	reusable := !req.Close && !resp.Close && !convert.HeaderHasToken(req.Header, "Connection", "close")
+	// release отдает соединение в пул, только когда запрос ушел целиком, а ответ дочитан
+	release := func(ok bool) {
+		if !ok {
+			// закрытое соединение заодно прерывает незаконченную запись тела
+			pc.close()
+		}
+		if werr := writeDone(); !ok || werr != nil {
+			pc.close()
+			return
+		}
+		err := pc.t.putIdle(pc)
+		if trace != nil && trace.PutIdleConn != nil {
+			trace.PutIdleConn(err)
+		}
+	}
+	if resp.Body == http.NoBody {
+		// если контекст успели отменить, соединение уже закрыто
+		release(stop() && reusable)
+		return resp, nil
+	}
+	// соединение возвращается в пул, только если тело дочитали ровно до конца
+	resp.Body = &bodyEOFSignal{
+		body:   resp.Body,
+		mapErr: pc.mapErr,
+		onDone: func(eof bool) {
+			release(stop() && reusable && eof)
+		},
+	}
+	if requestedCompression {
+		decompress(resp)
+	}
+	return resp, nil
+}
+
+// readResponse читает ответ, пропуская промежуточные 1xx. Если тело запроса придерживает gate,
+// 100 Continue открывает его, а окончательный ответ сообщает, что тело уже не нужно.
+// Ошибка из trace.Got1xxResponse прерывает запрос.
+func (pc *persistConn) readResponse(gate *continueGate, trace *httptrace.ClientTrace) (*http.Response, error) {
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		if _, err := pc.br.Peek(1); err != nil {
+			return nil, err
+		}
+		trace.GotFirstResponseByte()
+	}
+	for {
+		resp, err := convert.ParseResponse(pc.br)
+		if err != nil {
+			return nil, err
+		}
+		// 101 завершает обмен по HTTP, остальные 1xx - только подсказки перед ответом
+		if resp.StatusCode >= 200 || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, nil
+		}
+		if resp.StatusCode == http.StatusContinue {
+			if trace != nil && trace.Got100Continue != nil {
+				trace.Got100Continue()
+			}
+			if gate != nil {
+				gate.open(true)
+			}
+		}
+		if trace != nil && trace.Got1xxResponse != nil {
+			if err := trace.Got1xxResponse(resp.StatusCode, textproto.MIMEHeader(resp.Header)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// transportRequest добавляет к запросу заголовки уровня транспорта и сообщает,
+// запросил ли транспорт сжатый ответ сам
+func (pc *persistConn) transportRequest(req *http.Request) (_ *http.Request, requestedCompression bool) {
+	extra := make(http.Header)
+	// как и net/http, не просим сжатие, если вызывающий управляет им сам или ждет кусок тела по Range
+	if !pc.t.opts.disableCompression && req.Method != http.MethodHead &&
+		req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
+		extra.Set("Accept-Encoding", "gzip, deflate")
+		requestedCompression = true
+	}
+	if auth := proxyAuthorization(pc.proxyURL); auth != "" && req.Header.Get("Proxy-Authorization") == "" {
+		extra.Set("Proxy-Authorization", auth)
+	}
+	if len(extra) == 0 {
+		return req, requestedCompression
+	}
+	// заголовки вызывающего не трогаем
+	r2 := *req
+	r2.Header = req.Header.Clone()
+	if r2.Header == nil {
+		r2.Header = make(http.Header)
+	}
+	for key, values := range extra {
+		r2.Header[key] = values
+	}
+	return &r2, requestedCompression
+}
+
+func (pc *persistConn) writeRequest(req *http.Request) error {
+	if pc.proxyURL != nil {
+		return convert.WriteProxyRequest(pc.conn, req)
+	}
+	return convert.WriteRequest(pc.conn, req)
+}
+
+// decompress прозрачно распаковывает тело ответа, как это делает net/http: заголовки сжатия
+// удаляются, а длина распакованного тела заранее неизвестна
+func decompress(resp *http.Response) {
+	encoding := resp.Header.Get("Content-Encoding")
+	if resp.Body == http.NoBody || !convert.IsSupportedEncoding(encoding) {
+		return
+	}
+	body, err := convert.NewDecodingReader(resp.Body, encoding)
+	if err != nil {
+		return
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// cancel закрывает соединение из-за отмены контекста запроса
+func (pc *persistConn) cancel(err error) {
+	pc.cancelMu.Lock()
+	pc.cancelErr = err
+	pc.cancelMu.Unlock()
+	_ = pc.conn.Close()
+}
+
+// mapErr заменяет ошибку ввода-вывода на ошибку контекста, если соединение закрыто из-за отмены
+func (pc *persistConn) mapErr(err error) error {
+	pc.cancelMu.Lock()
+	defer pc.cancelMu.Unlock()
+
+	if pc.cancelErr != nil {
+		return pc.cancelErr
+	}
+	return err
+}
+
+// startIdle готовит соединение к простою в пуле
+func (pc *persistConn) startIdle(timeout time.Duration) error {
+	pc.watch = make(chan error, 1)
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return pc.conn.SetReadDeadline(deadline)
+}
+
+// watchIdle караулит соединение, пока оно в пуле. Истекший таймаут простоя, закрытие со стороны
+// сервера или неожиданные данные означают, что соединение больше не годится.
+func (pc *persistConn) watchIdle() {
+	_, err := pc.br.Peek(1)
+
+	pc.t.mu.Lock()
+	stillIdle := pc.idle
+	if stillIdle {
+		pc.t.removeIdleLocked(pc)
+	}
+	pc.t.mu.Unlock()
+
+	pc.watch <- err
+	if stillIdle {
+		pc.close()
+	}
+}
+
+// wakeUp забирает соединение у watchIdle и сообщает, годится ли оно для нового запроса
+func (pc *persistConn) wakeUp() bool {
+	_ = pc.conn.SetReadDeadline(aLongTimeAgo)
+	err := <-pc.watch
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return false
+	}
+	pc.reused = true
+	return pc.conn.SetReadDeadline(time.Time{}) == nil
+}
+
+func (pc *persistConn) close() {
+	pc.once.Do(func() {
+		_ = pc.conn.Close()
+		pc.t.connClosed(pc.key)
+	})
+}
+
+// bodyEOFSignal вызывает onDone ровно один раз: с eof=true, когда тело прочитано до конца,
+// и с eof=false при ошибке чтения или закрытии недочитанного тела
+type bodyEOFSignal struct {
+	body   io.ReadCloser
+	mu     sync.Mutex
+	done   bool
+	onDone func(eof bool)
+	mapErr func(error) error // подменяет ошибку чтения, например на ошибку контекста
+}
+
+func (b *bodyEOFSignal) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if err != nil {
+		if err != io.EOF && b.mapErr != nil {
+			err = b.mapErr(err)
+		}
+		b.finish(err == io.EOF)
+	}
+	return n, err
+}
+
+func (b *bodyEOFSignal) Close() error {
+	b.finish(false)
+	return b.body.Close()
+}
+
+func (b *bodyEOFSignal) finish(eof bool) {
+	b.mu.Lock()
+	if b.done {
+		b.mu.Unlock()
+		return
+	}
+	b.done = true
+	b.mu.Unlock()
+
+	b.onDone(eof)
+}
+
+// errBodyNotSent - сервер ответил, не дождавшись тела, и оно так и не было отправлено
+var errBodyNotSent = errors.New("request body not sent: server replied before 100 Continue")
+
+// continueGate придерживает тело запроса с Expect: 100-continue, пока не станет ясно, нужно ли оно
+// серверу. Не дождавшись ответа за timeout, тело отправляется все равно, как в net/http.
+type continueGate struct {
+	body    io.ReadCloser
+	timeout time.Duration
+	trace   *httptrace.ClientTrace
+	send    chan bool
+	once    sync.Once
+	waited  bool
+}
+
+func newContinueGate(body io.ReadCloser, timeout time.Duration, trace *httptrace.ClientTrace) *continueGate {
+	return &continueGate{body: body, timeout: timeout, trace: trace, send: make(chan bool, 1)}
+}
+
+// open сообщает телу, отправлять ли его; учитывается только первый вызов
+func (g *continueGate) open(send bool) {
+	g.once.Do(func() {
+		g.send <- send
+	})
+}
+
+func (g *continueGate) Read(p []byte) (int, error) {
+	if !g.waited {
+		g.waited = true
+		if g.trace != nil && g.trace.Wait100Continue != nil {
+			g.trace.Wait100Continue()
+		}
+		timer := time.NewTimer(g.timeout)
+		defer timer.Stop()
+		select {
+		case send := <-g.send:
+			if !send {
+				return 0, errBodyNotSent
+			}
+		case <-timer.C:
+		}
+	}
+	return g.body.Read(p)
+}
+
+func (g *continueGate) Close() error {
+	return g.body.Close()
+}
+
+// connectError - не удалось получить соединение для запроса
+type connectError struct {
+	err error
+}
+
+func (e connectError) Error() string {
+	return e.err.Error()
+}
+
+func (e connectError) Unwrap() error {
+	return e.err
+}
+
+// requestWriteError - запрос не удалось отправить целиком
+type requestWriteError struct {
+	err error
+}
+
+func (e requestWriteError) Error() string {
+	return e.err.Error()
+}
+
+func (e requestWriteError) Unwrap() error {
+	return e.err
+}
+
+func hasBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
+)
+
+// connectTunnel просит прокси открыть туннель до addr и ждет 200 в ответ
+func connectTunnel(ctx context.Context, conn net.Conn, addr string, proxyURL *url.URL) (err error) {
+	// CONNECT тоже должен прерываться отменой контекста
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.Close()
+	})
+	defer func() {
+		if !stop() && err != nil {
+			err = ctx.Err()
+		}
+	}()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if auth := proxyAuthorization(proxyURL); auth != "" {
+		req.Header.Set("Proxy-Authorization", auth)
+	}
+	if err := convert.WriteRequest(conn, req); err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := convert.ParseResponse(br)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("proxy refused CONNECT to %s: %d %s", addr, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	// дальше по соединению идет TLS с сервером, прокси не должен был прислать ничего сверх ответа
+	if br.Buffered() > 0 {
+		return errors.New("unexpected data from proxy after CONNECT response")
+	}
+	return nil
+}
+
+// proxyAuthorization собирает Basic-авторизацию из логина и пароля в URL прокси
+func proxyAuthorization(proxyURL *url.URL) string {
+	if proxyURL == nil || proxyURL.User == nil {
+		return ""
+	}
+	password, _ := proxyURL.User.Password()
+	creds := proxyURL.User.Username() + ":" + password
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds))
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// defaultMaxRedirects - после скольких редиректов подряд клиент по умолчанию сдается, как в net/http
+	defaultMaxRedirects = 10
+	// maxRedirectBodyDrain - сколько тела промежуточного ответа дочитываем, чтобы вернуть соединение в пул
+	maxRedirectBodyDrain = 2 << 10
+)
+
+// defaultCheckRedirect разрешает не больше defaultMaxRedirects редиректов подряд
+func defaultCheckRedirect(_ *http.Request, via []*http.Request) error {
+	if len(via) >= defaultMaxRedirects {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
+
+// redirectBehavior решает, идти ли по редиректу, каким методом и с телом ли исходного запроса.
+// Правила те же, что у http.Client: 301, 302 и 303 превращают все, кроме GET и HEAD, в GET без тела,
+// а 307 и 308 повторяют запрос как есть, если тело можно отправить заново.
+func redirectBehavior(method string, resp *http.Response, ireq *http.Request) (redirectMethod string, shouldRedirect, includeBody bool) {
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther:
+		redirectMethod = method
+		shouldRedirect = true
+		if method != http.MethodGet && method != http.MethodHead {
+			redirectMethod = http.MethodGet
+		}
+	case http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		redirectMethod = method
+		shouldRedirect = true
+		includeBody = true
+		if ireq.GetBody == nil && ireq.Body != nil && ireq.Body != http.NoBody {
+			shouldRedirect = false
+		}
+	}
+	if resp.Header.Get("Location") == "" {
+		shouldRedirect = false
+	}
+	return redirectMethod, shouldRedirect, includeBody
+}
+
+// newRedirectRequest собирает запрос по адресу из Location ответа на req.
+// header - заголовки, которые переносятся с запроса на запрос; чувствительные из них
+// удаляются навсегда, как только редирект уводит на другой хост.
+func newRedirectRequest(ireq, req *http.Request, resp *http.Response, header http.Header, method string, includeBody bool) (*http.Request, error) {
+	loc := resp.Header.Get("Location")
+	u, err := req.URL.Parse(loc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Host, заданный вызывающим, сохраняем только для относительных редиректов
+	var host string
+	if ireq.Host != "" && ireq.Host != ireq.URL.Host {
+		if lu, _ := url.Parse(loc); lu != nil && !lu.IsAbs() {
+			host = ireq.Host
+		}
+	}
+
+	if !sameOrSubdomain(req.URL, u) {
+		for _, key := range []string{"Authorization", "Www-Authenticate", "Cookie", "Cookie2", "Proxy-Authorization"} {
+			header.Del(key)
+		}
+	}
+	if !includeBody {
+		header.Del("Content-Type")
+		header.Del("Content-Length")
+	}
+
+	next := (&http.Request{
+		Method: method,
+		URL:    u,
+		Header: header.Clone(),
+		Host:   host,
+	}).WithContext(ireq.Context())
+	if includeBody && ireq.GetBody != nil {
+		body, err := ireq.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		next.Body = body
+		next.GetBody = ireq.GetBody
+		next.ContentLength = ireq.ContentLength
+	}
+	if ref := refererForURL(req.URL, u); ref != "" && next.Header.Get("Referer") == "" {
+		next.Header.Set("Referer", ref)
+	}
+	return next, nil
+}
+
+// sameOrSubdomain сообщает, что dst - тот же хост, что и src, или его поддомен.
+// Только на такие хосты можно переносить Authorization и cookie.
+func sameOrSubdomain(src, dst *url.URL) bool {
+	shost := strings.ToLower(src.Hostname())
+	dhost := strings.ToLower(dst.Hostname())
+	if shost == dhost {
+		return true
+	}
+	return strings.HasSuffix(dhost, "."+shost)
+}
+
+// refererForURL возвращает значение Referer для перехода с lastReq на newReq.
+// С https на http Referer не передается, данные пользователя из URL вырезаются.
+func refererForURL(lastReq, newReq *url.URL) string {
+	if lastReq.Scheme == "https" && newReq.Scheme == "http" {
+		return ""
+	}
+	ref := *lastReq
+	ref.User = nil
+	ref.Fragment = ""
+	return ref.String()
+}
+
+// discardBody дочитывает небольшое тело промежуточного ответа, чтобы соединение вернулось в пул
+func discardBody(body io.ReadCloser) {
+	_, _ = io.CopyN(io.Discard, body, maxRedirectBodyDrain)
+	_ = body.Close()
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	// defaultRetryBaseDelay - пауза перед первым повтором, дальше она удваивается
+	defaultRetryBaseDelay = 100 * time.Millisecond
+	// defaultRetryMaxDelay - дольше этого между попытками не ждем
+	defaultRetryMaxDelay = 10 * time.Second
+)
+
+// defaultRetryStatuses - ответы, которые обычно означают временную недоступность сервера
+var defaultRetryStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// RetryPolicy описывает, как клиент повторяет неудавшиеся запросы, см. WithRetry
+type RetryPolicy struct {
+	// MaxAttempts - сколько всего попыток, включая первую; 1 и меньше - повторов нет
+	MaxAttempts int
+	// Statuses - коды ответа, на которые запрос повторяется; nil - 502, 503 и 504
+	Statuses []int
+	// BaseDelay - пауза перед первым повтором, каждая следующая вдвое дольше; 0 - 100 мс
+	BaseDelay time.Duration
+	// MaxDelay - самая долгая пауза между попытками; 0 - 10 секунд
+	MaxDelay time.Duration
+}
+
+// RetryError - ошибка последней попытки запроса, который клиент уже повторял
+type RetryError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("%v (after %d attempts)", e.Err, e.Attempts)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// attemptsKey - ключ контекста запроса, в котором лежит номер попытки
+type attemptsKey struct{}
+
+// Attempts возвращает, с какой попытки клиент получил resp: 1 - повторов не было.
+// После редиректов считаются попытки только последнего запроса цепочки.
+func Attempts(resp *http.Response) int {
+	if resp == nil || resp.Request == nil {
+		return 0
+	}
+	if n, ok := resp.Request.Context().Value(attemptsKey{}).(int); ok {
+		return n
+	}
+	return 1
+}
+
+// sendWithRetry отправляет запрос, повторяя его по политике WithRetry. Ответ с кодом из
+// Statuses после последней попытки возвращается как есть, а ошибка оборачивается в *RetryError.
+func (m *myClient) sendWithRetry(req *http.Request) (*http.Response, error) {
+	p := m.retry
+	if p.MaxAttempts <= 1 {
+		return m.send(req)
+	}
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		resp, err := m.send(req.WithContext(context.WithValue(ctx, attemptsKey{}, attempt)))
+
+		last := attempt >= p.MaxAttempts || !retryableRequest(req)
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if last || ctx.Err() != nil || !retryableError(err) {
+				return nil, retryError(attempt, err)
+			}
+			delay = p.backoff(attempt)
+		case p.retryStatus(resp.StatusCode) && !last:
+			var ok bool
+			if delay, ok = p.retryAfter(resp, attempt); !ok {
+				// сервер просит подождать дольше, чем мы готовы, - отдаем его ответ
+				return resp, nil
+			}
+			discardBody(resp.Body)
+		default:
+			return resp, nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, retryError(attempt, ctx.Err())
+		case <-timer.C:
+		}
+		if req, err = rewindBody(req); err != nil {
+			return nil, retryError(attempt, err)
+		}
+	}
+}
+
+// retryError оборачивает ошибку в *RetryError, только если попыток было больше одной
+func retryError(attempts int, err error) error {
+	if attempts == 1 {
+		return err
+	}
+	return &RetryError{Attempts: attempts, Err: err}
+}
+
+// retryableRequest сообщает, можно ли отправить запрос еще раз: он идемпотентен или несет
+// Idempotency-Key, а его тело можно пересоздать через GetBody
+func retryableRequest(req *http.Request) bool {
+	if !IsIdempotent(req) {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryableError сообщает, похожа ли ошибка на временный сбой соединения. Ошибки проверки
+// сертификата и неверные запросы повтор не исправит.
+func retryableError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	var we requestWriteError
+	var netErr net.Error
+	return errors.As(err, &we) || errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+func (p RetryPolicy) retryStatus(code int) bool {
+	statuses := p.Statuses
+	if statuses == nil {
+		statuses = defaultRetryStatuses
+	}
+	return slices.Contains(statuses, code)
+}
+
+// backoff возвращает паузу перед повтором номер attempt: экспоненциальный рост от BaseDelay
+// до MaxDelay, из которого случайна половина, чтобы клиенты не повторяли запросы одновременно
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d, maxDelay := p.delays()
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryAfter возвращает паузу перед повтором ответа resp. Если сервер прислал Retry-After
+// (секунды или HTTP-дата), ждем столько, сколько он просит; false - это дольше MaxDelay.
+func (p RetryPolicy) retryAfter(resp *http.Response, attempt int) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return p.backoff(attempt), true
+	}
+	var d time.Duration
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		d = time.Duration(secs) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		d = max(time.Until(at), 0)
+	} else {
+		return p.backoff(attempt), true
+	}
+	_, maxDelay := p.delays()
+	return d, d <= maxDelay
+}
+
+func (p RetryPolicy) delays() (base, maxDelay time.Duration) {
+	base, maxDelay = p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = defaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	return min(base, maxDelay), maxDelay
+}
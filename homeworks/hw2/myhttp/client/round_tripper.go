@@ -0,0 +1,41 @@
+package client
+
+import (
+	"net/http"
+)
+
+// Transport - клиент myhttp в виде http.RoundTripper, чтобы его можно было подложить
+// в http.Client: &http.Client{Transport: client.NewTransport()}.
+// Как и положено RoundTripper, он отправляет ровно один запрос: не ходит по редиректам,
+// не работает с cookie и не ограничивает время запроса - этим занимается http.Client, - а также
+// не повторяет запрос. Поэтому опции WithCheckRedirect, WithCookieJar, WithTimeout и WithRetry
+// здесь не действуют.
+type Transport struct {
+	t *transport
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// NewTransport создает Transport с пулом keep-alive соединений
+func NewTransport(opts ...Option) *Transport {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &Transport{t: newTransport(o)}
+}
+
+// RoundTrip отправляет запрос и возвращает ответ. Тело запроса закрывается всегда, в том числе при ошибке.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.t.roundTrip(req)
+	if err != nil && req != nil && req.Body != nil {
+		_ = req.Body.Close()
+	}
+	return resp, err
+}
+
+// CloseIdleConnections закрывает соединения, простаивающие в пуле. Его вызывает
+// http.Client.CloseIdleConnections.
+func (t *Transport) CloseIdleConnections() {
+	t.t.closeIdleConnections()
+}
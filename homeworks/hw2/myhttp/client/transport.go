@@ -0,0 +1,414 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Причины, по которым соединение не вернулось в пул; их получает httptrace.ClientTrace.PutIdleConn
+var (
+	errKeepAlivesDisabled = errors.New("idle connections disabled")
+	errConnDesynced       = errors.New("unread data after response")
+	errTooManyIdle        = errors.New("too many idle connections for host")
+)
+
+// transport отправляет один запрос и держит пул keep-alive соединений по host:port
+type transport struct {
+	opts options
+
+	mu      sync.Mutex
+	idle    map[connKey][]*persistConn
+	conns   map[connKey]int             // открытые соединения на host:port
+	waiters map[connKey][]chan struct{} // запросы, ждущие освобождения лимита maxConnsPerHost
+}
+
+// connKey определяет, какие запросы могут делить одно соединение
+type connKey struct {
+	proxy      string // URL прокси, пустой - подключаемся к серверу напрямую
+	scheme     string
+	addr       string // host:port сервера; пустой для http через прокси - такие соединения общие для всех серверов
+	serverName string // имя для SNI и проверки сертификата, только для https
+}
+
+func newTransport(opts options) *transport {
+	return &transport{
+		opts:    opts,
+		idle:    make(map[connKey][]*persistConn),
+		conns:   make(map[connKey]int),
+		waiters: make(map[connKey][]chan struct{}),
+	}
+}
+
+func (t *transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if req == nil {
+		return nil, errors.New("request is nil")
+	}
+	if req.URL == nil {
+		return nil, errors.New("request URL is nil")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported protocol scheme %q", req.URL.Scheme)
+	}
+	key, err := t.connKeyFor(req)
+	if err != nil {
+		return nil, err
+	}
+
+	trace := httptrace.ContextClientTrace(req.Context())
+	for {
+		if trace != nil && trace.GetConn != nil {
+			trace.GetConn(canonicalAddr(req.URL))
+		}
+		pc, err := t.getConn(req.Context(), key)
+		if err != nil {
+			return nil, connectError{err: err}
+		}
+		if trace != nil && trace.GotConn != nil {
+			info := httptrace.GotConnInfo{Conn: pc.conn, Reused: pc.reused, WasIdle: pc.reused}
+			if pc.reused {
+				info.IdleTime = time.Since(pc.idleAt)
+			}
+			trace.GotConn(info)
+		}
+		resp, err := pc.roundTrip(req)
+		if err == nil {
+			return resp, nil
+		}
+		pc.close()
+
+		// сервер мог закрыть простаивавшее соединение ровно в момент отправки,
+		// тогда повторяем запрос на свежем соединении
+		if !pc.reused || req.Context().Err() != nil || !canRetry(req, err) {
+			return nil, err
+		}
+		rewound, rerr := rewindBody(req)
+		if rerr != nil {
+			return nil, err
+		}
+		req = rewound
+	}
+}
+
+// getConn берет соединение из пула или открывает новое, соблюдая maxConnsPerHost
+func (t *transport) getConn(ctx context.Context, key connKey) (*persistConn, error) {
+	for {
+		t.mu.Lock()
+		if pc := t.popIdleLocked(key); pc != nil {
+			t.mu.Unlock()
+			if pc.wakeUp() {
+				return pc, nil
+			}
+			pc.close()
+			continue
+		}
+
+		if t.opts.maxConnsPerHost <= 0 || t.conns[key] < t.opts.maxConnsPerHost {
+			t.conns[key]++
+			t.mu.Unlock()
+			return t.dial(ctx, key)
+		}
+
+		wait := make(chan struct{})
+		t.waiters[key] = append(t.waiters[key], wait)
+		t.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (t *transport) dial(ctx context.Context, key connKey) (*persistConn, error) {
+	conn, proxyURL, err := t.dialConn(ctx, key)
+	if err != nil {
+		t.connClosed(key)
+		return nil, err
+	}
+	pc := newPersistConn(t, key, conn)
+	if proxyURL != nil && key.scheme == "http" {
+		// обычные http-запросы уходят прокси целиком, он сам пересылает их серверу
+		pc.proxyURL = proxyURL
+	}
+	return pc, nil
+}
+
+// dialConn открывает соединение с сервером напрямую или через прокси.
+// Для https через прокси сначала поднимается туннель через CONNECT, а TLS идет уже внутри него.
+func (t *transport) dialConn(ctx context.Context, key connKey) (net.Conn, *url.URL, error) {
+	addr := key.addr
+	var proxyURL *url.URL
+	if key.proxy != "" {
+		var err error
+		if proxyURL, err = url.Parse(key.proxy); err != nil {
+			return nil, nil, err
+		}
+		addr = canonicalAddr(proxyURL)
+	}
+
+	dial := t.opts.dialContext
+	if dial == nil {
+		var d net.Dialer
+		dial = d.DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if proxyURL != nil && proxyURL.Scheme == "https" {
+		if conn, err = t.handshake(ctx, conn, proxyURL.Hostname()); err != nil {
+			return nil, nil, err
+		}
+	}
+	if proxyURL != nil && key.scheme == "https" {
+		if err := connectTunnel(ctx, conn, key.addr, proxyURL); err != nil {
+			_ = conn.Close()
+			return nil, nil, err
+		}
+	}
+	if key.scheme == "https" {
+		if conn, err = t.handshake(ctx, conn, key.serverName); err != nil {
+			return nil, nil, err
+		}
+	}
+	return conn, proxyURL, nil
+}
+
+// handshake поднимает TLS поверх conn; при ошибке conn закрывается
+func (t *transport) handshake(ctx context.Context, conn net.Conn, serverName string) (net.Conn, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+	tlsConn := tls.Client(conn, t.tlsConfig(serverName))
+	err := tlsConn.HandshakeContext(ctx)
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// tlsConfig возвращает копию настроенного tls.Config с ServerName для конкретного хоста
+func (t *transport) tlsConfig(serverName string) *tls.Config {
+	var cfg *tls.Config
+	if t.opts.tlsConfig != nil {
+		cfg = t.opts.tlsConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = serverName
+	}
+	if len(cfg.NextProtos) == 0 {
+		// HTTP/2 мы не умеем, поэтому явно договариваемся об HTTP/1.1
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+	return cfg
+}
+
+// putIdle возвращает соединение в пул после полностью прочитанного ответа.
+// Если соединение в пул не попало, оно закрывается, а putIdle возвращает причину.
+func (t *transport) putIdle(pc *persistConn) error {
+	if t.opts.maxIdleConnsPerHost <= 0 {
+		pc.close()
+		return errKeepAlivesDisabled
+	}
+	// лишние байты после ответа означают, что соединение рассинхронизировано
+	if pc.br.Buffered() > 0 {
+		pc.close()
+		return errConnDesynced
+	}
+	if err := pc.startIdle(t.opts.idleConnTimeout); err != nil {
+		pc.close()
+		return err
+	}
+
+	t.mu.Lock()
+	if len(t.idle[pc.key]) >= t.opts.maxIdleConnsPerHost {
+		t.mu.Unlock()
+		pc.close()
+		return errTooManyIdle
+	}
+	pc.idle = true
+	pc.idleAt = time.Now()
+	t.idle[pc.key] = append(t.idle[pc.key], pc)
+	t.wakeWaitersLocked(pc.key)
+	t.mu.Unlock()
+
+	go pc.watchIdle()
+	return nil
+}
+
+// popIdleLocked достает самое свежее простаивающее соединение
+func (t *transport) popIdleLocked(key connKey) *persistConn {
+	list := t.idle[key]
+	if len(list) == 0 {
+		return nil
+	}
+	pc := list[len(list)-1]
+	t.idle[key] = list[:len(list)-1]
+	pc.idle = false
+	return pc
+}
+
+func (t *transport) removeIdleLocked(pc *persistConn) {
+	list := t.idle[pc.key]
+	for i, v := range list {
+		if v == pc {
+			t.idle[pc.key] = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	pc.idle = false
+}
+
+// connClosed освобождает место в лимите maxConnsPerHost
+func (t *transport) connClosed(key connKey) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conns[key]--
+	if t.conns[key] <= 0 {
+		delete(t.conns, key)
+	}
+	t.wakeWaitersLocked(key)
+}
+
+// wakeWaitersLocked будит всех ждущих: каждый заново попробует взять соединение
+func (t *transport) wakeWaitersLocked(key connKey) {
+	for _, wait := range t.waiters[key] {
+		close(wait)
+	}
+	delete(t.waiters, key)
+}
+
+// closeIdleConnections закрывает все простаивающие соединения
+func (t *transport) closeIdleConnections() {
+	t.mu.Lock()
+	var idle []*persistConn
+	for key, list := range t.idle {
+		for _, pc := range list {
+			pc.idle = false
+		}
+		idle = append(idle, list...)
+		delete(t.idle, key)
+	}
+	t.mu.Unlock()
+
+	for _, pc := range idle {
+		pc.close()
+	}
+}
+
+// canRetry сообщает, можно ли безопасно повторить запрос, упавший на переиспользованном соединении.
+// Если запрос не удалось даже отправить, сервер его не обработал; если оборвалось чтение ответа,
+// повторяем только идемпотентные запросы.
+func canRetry(req *http.Request, err error) bool {
+	var we requestWriteError
+	if errors.As(err, &we) {
+		return true
+	}
+	if !errors.Is(err, io.EOF) && !errors.Is(err, syscall.ECONNRESET) {
+		return false
+	}
+	return IsIdempotent(req)
+}
+
+// IsIdempotent сообщает, можно ли отправить запрос повторно, не рискуя выполнить его дважды:
+// метод идемпотентен (RFC 9110, 9.2.2) или запрос несет заголовок Idempotency-Key
+func IsIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// RequestNotSent сообщает, что запрос упал с ошибкой err, так и не дойдя до сервера целиком:
+// не удалось подключиться или записать запрос. Сервер его не обрабатывал, поэтому повторить
+// такой запрос безопасно при любом методе.
+func RequestNotSent(err error) bool {
+	var ce connectError
+	var we requestWriteError
+	return errors.As(err, &ce) || errors.As(err, &we)
+}
+
+// rewindBody готовит запрос к повторной отправке, пересоздавая тело через GetBody
+func rewindBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	if req.GetBody == nil {
+		return nil, errors.New("cannot retry request: body is not rewindable")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.Body = body
+	return &newReq, nil
+}
+
+// connKeyFor возвращает ключ пула для запроса. Для https имя сервера берется из req.Host,
+// если он задан, иначе из URL.
+func (t *transport) connKeyFor(req *http.Request) (connKey, error) {
+	key := connKey{scheme: req.URL.Scheme, addr: canonicalAddr(req.URL)}
+	if key.scheme == "https" {
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		key.serverName = strings.Trim(host, "[]")
+	}
+
+	if t.opts.proxy == nil {
+		return key, nil
+	}
+	proxyURL, err := t.opts.proxy(req)
+	if err != nil {
+		return connKey{}, err
+	}
+	if proxyURL == nil {
+		return key, nil
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return connKey{}, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	key.proxy = proxyURL.String()
+	if key.scheme == "http" {
+		key.addr = ""
+	}
+	return key, nil
+}
+
+// canonicalAddr возвращает host:port из URL, подставляя порт по умолчанию для схемы
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
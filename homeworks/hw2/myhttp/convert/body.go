@@ -0,0 +1,202 @@
+package convert
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// fixedReader читает ровно n байт тела, заданного через Content-Length.
+// В отличие от io.LimitReader, обрыв потока раньше времени - это ошибка, а не EOF.
+type fixedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (f *fixedReader) Read(p []byte) (int, error) {
+	if f.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > f.n {
+		p = p[:f.n]
+	}
+	n, err := f.r.Read(p)
+	f.n -= int64(n)
+	if err == io.EOF {
+		if f.n > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	if err == nil && f.n == 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// chunkedReader декодирует тело в формате Transfer-Encoding: chunked.
+// EOF возвращается только после того, как прочитан завершающий чанк и трейлер,
+// чтобы на том же соединении можно было читать следующее сообщение.
+type chunkedReader struct {
+	r        *bufio.Reader
+	n        uint64 // сколько байт осталось в текущем чанке
+	needCRLF bool   // нужно дочитать \r\n после данных чанка
+	err      error
+	// trailer заполняется полями трейлера, когда тело дочитано; nil - трейлер отбрасывается
+	trailer http.Header
+	strict  bool // строки обязаны заканчиваться на \r\n
+	// maxTrailerBytes ограничивает трейлер, иначе в конце тела можно прислать сколько угодно
+	// полей, и все они осядут в памяти; 0 - без ограничения
+	maxTrailerBytes int
+}
+
+// maxChunkLineLength ограничивает строку с размером чанка: иначе расширениями чанка
+// можно заставить сервер буферизовать сколько угодно, не отправив ни байта тела
+const maxChunkLineLength = 4096
+
+func newChunkedReader(r *bufio.Reader, trailer http.Header, strict bool, maxTrailerBytes int) *chunkedReader {
+	return &chunkedReader{r: r, trailer: trailer, strict: strict, maxTrailerBytes: max(maxTrailerBytes, 0)}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	if c.n == 0 {
+		if c.err = c.beginChunk(); c.err != nil {
+			return 0, c.err
+		}
+	}
+	if uint64(len(p)) > c.n {
+		p = p[:c.n]
+	}
+	n, err := c.r.Read(p)
+	c.n -= uint64(n)
+	if c.n == 0 {
+		c.needCRLF = true
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	c.err = err
+	return n, err
+}
+
+// beginChunk читает заголовок следующего чанка. На последнем чанке дочитывает
+// трейлер и возвращает io.EOF.
+func (c *chunkedReader) beginChunk() error {
+	if c.needCRLF {
+		line, err := readLine(c.r, c.strict, maxChunkLineLength)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if line != "" {
+			return parseError(ErrMalformedChunk, line)
+		}
+		c.needCRLF = false
+	}
+
+	line, err := readLine(c.r, c.strict, maxChunkLineLength)
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	// расширения чанка (;name=value) нам не нужны
+	sizeStr := line
+	if i := strings.IndexByte(sizeStr, ';'); i >= 0 {
+		sizeStr = sizeStr[:i]
+	}
+	// пробелы допустимы только перед расширениями, не перед самим размером
+	size, err := strconv.ParseUint(strings.TrimRight(sizeStr, " \t"), 16, 63)
+	if err != nil {
+		return parseError(ErrMalformedChunk, line)
+	}
+	if size == 0 {
+		// трейлер: заголовки до пустой строки
+		fields, err := readHeader(c.r, c.strict, c.maxTrailerBytes)
+		if err != nil {
+			return err
+		}
+		for key, values := range fields {
+			if c.trailer != nil && !ForbiddenTrailerKey(key) {
+				c.trailer[key] = append(c.trailer[key], values...)
+			}
+		}
+		return io.EOF
+	}
+	c.n = size
+	return nil
+}
+
+// NewChunkedWriter возвращает writer, который кодирует данные в формате Transfer-Encoding: chunked:
+// каждый Write становится отдельным чанком. Close пишет завершающий чанк и поля trailer
+// со значениями на момент Close, но не закрывает w. trailer может быть nil.
+func NewChunkedWriter(w io.Writer, trailer http.Header) io.WriteCloser {
+	return &chunkedWriter{w: w, trailer: trailer}
+}
+
+type chunkedWriter struct {
+	w       io.Writer
+	trailer http.Header
+}
+
+func (c *chunkedWriter) Write(p []byte) (int, error) {
+	// пустой чанк означает конец тела, поэтому пустые записи пропускаем
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if _, err := fmt.Fprintf(c.w, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := c.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if _, err := io.WriteString(c.w, "\r\n"); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+func (c *chunkedWriter) Close() error {
+	if _, err := io.WriteString(c.w, "0\r\n"); err != nil {
+		return err
+	}
+	if err := writeHeader(c.w, c.trailer); err != nil {
+		return err
+	}
+	_, err := io.WriteString(c.w, "\r\n")
+	return err
+}
+
+// flushWriter после каждой записи в w сбрасывает буфер соединения, чтобы тело уходило
+// по мере чтения из источника, а не копилось до конца: это нужно, например, прокси
+type flushWriter struct {
+	w  io.Writer
+	bw *bufio.Writer
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, f.bw.Flush()
+}
+
+// flushAfterWrite оборачивает w во flushWriter, если под ним буфер соединения
+func flushAfterWrite(w, conn io.Writer) io.Writer {
+	if bw, ok := conn.(*bufio.Writer); ok {
+		return flushWriter{w: w, bw: bw}
+	}
+	return w
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
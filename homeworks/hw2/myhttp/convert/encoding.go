@@ -0,0 +1,103 @@
+package convert
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Encoder сжимает тело по Content-Encoding. Flush отправляет все записанное, не завершая поток,
+// Close дописывает конец сжатого потока, но не закрывает нижний writer.
+type Encoder interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// IsSupportedEncoding сообщает, умеют ли NewEncoder и NewDecodingReader работать с encoding
+func IsSupportedEncoding(encoding string) bool {
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip", "deflate":
+		return true
+	}
+	return false
+}
+
+// NewEncoder возвращает writer, который сжимает данные по encoding (gzip или deflate) и пишет их в w
+func NewEncoder(w io.Writer, encoding string) (Encoder, error) {
+	switch strings.ToLower(encoding) {
+	case "gzip", "x-gzip":
+		return gzip.NewWriter(w), nil
+	case "deflate":
+		// в HTTP deflate - это поток zlib (RFC 9110, 8.4.1.2)
+		return zlib.NewWriter(w), nil
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// NewDecodingReader возвращает тело, распакованное по encoding. Распаковщик создается при первом
+// чтении, поэтому ошибка формата тоже приходит из Read. Когда сжатый поток закончился,
+// тело дочитывается до конца, чтобы соединение можно было переиспользовать.
+func NewDecodingReader(body io.ReadCloser, encoding string) (io.ReadCloser, error) {
+	if !IsSupportedEncoding(encoding) {
+		return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	return &decodingReader{body: body, encoding: strings.ToLower(encoding)}, nil
+}
+
+type decodingReader struct {
+	body     io.ReadCloser
+	encoding string
+	zr       io.Reader
+	err      error
+}
+
+func (d *decodingReader) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.zr == nil {
+		if d.zr, d.err = d.newReader(); d.err != nil {
+			return 0, d.err
+		}
+	}
+	n, err := d.zr.Read(p)
+	if err == io.EOF {
+		// за концом сжатого потока ничего быть не должно, но тело нужно дочитать до EOF
+		if _, derr := io.Copy(io.Discard, d.body); derr != nil {
+			err = derr
+		}
+	}
+	d.err = err
+	return n, err
+}
+
+func (d *decodingReader) newReader() (io.Reader, error) {
+	switch d.encoding {
+	case "gzip", "x-gzip":
+		return gzip.NewReader(d.body)
+	default:
+		// часть серверов присылает под именем deflate голый поток без заголовка zlib
+		br := bufio.NewReader(d.body)
+		header, err := br.Peek(2)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if isZlibHeader(header) {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	}
+}
+
+func (d *decodingReader) Close() error {
+	return d.body.Close()
+}
+
+// isZlibHeader проверяет первые два байта потока zlib (RFC 1950, 2.2)
+func isZlibHeader(b []byte) bool {
+	return b[0]&0x0f == 8 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0
+}
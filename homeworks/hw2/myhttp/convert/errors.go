@@ -0,0 +1,61 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Причины, по которым входящее сообщение отвергается как нарушающее RFC 9112.
+// Проверять их стоит через errors.Is: разбор возвращает их обернутыми в *ParseError.
+var (
+	ErrMalformedRequestLine = errors.New("malformed request line")
+	ErrMalformedStatusLine  = errors.New("malformed status line")
+	ErrUnsupportedVersion   = errors.New("unsupported protocol version")
+	ErrMalformedHeader      = errors.New("malformed header line")
+	ErrInvalidHeaderName    = errors.New("invalid header field name")
+	// ErrObsFold - строка заголовка начинается с пробела: устаревший перенос значения (obs-fold)
+	ErrObsFold = errors.New("obsolete header line folding")
+	// ErrBareLF - строка закончилась \n без \r, отвергается только в строгом режиме
+	ErrBareLF = errors.New("bare LF line ending")
+	// ErrContentLengthWithTransferEncoding - длину тела можно указать только одним способом
+	ErrContentLengthWithTransferEncoding = errors.New("both Content-Length and Transfer-Encoding")
+	// ErrInvalidContentLength - Content-Length не число, повторяется или противоречит сам себе
+	ErrInvalidContentLength        = errors.New("invalid Content-Length")
+	ErrUnsupportedTransferEncoding = errors.New("unsupported Transfer-Encoding")
+	ErrMalformedChunk              = errors.New("malformed chunked encoding")
+	// ErrTransferEncodingHTTP10 - Transfer-Encoding в запросе HTTP/1.0: это не неподдерживаемое
+	// кодирование, а нарушение протокола, поэтому сервер отвечает 400, а не 501
+	ErrTransferEncodingHTTP10 = errors.New("Transfer-Encoding in HTTP/1.0 request")
+	// ErrLineTooLong - строка длиннее лимита readLine: строка с размером чанка длиннее maxChunkLineLength.
+	// Строки заголовков и трейлера тоже ограничены, но их превышение разбор отдает как ErrHeaderTooLarge.
+	ErrLineTooLong   = errors.New("line too long")
+	ErrBadTrailerKey = errors.New("bad trailer key")
+	// ErrMissingHost - в запросе HTTP/1.1 нет заголовка Host
+	ErrMissingHost = errors.New("missing Host header")
+	// ErrDuplicateHost - заголовок Host повторяется
+	ErrDuplicateHost = errors.New("duplicate Host header")
+	// ErrHeaderTooLarge - заголовки или трейлер сообщения длиннее лимита
+	ErrHeaderTooLarge = errors.New("header section too large")
+)
+
+// ParseError - входящее сообщение нарушает синтаксис HTTP/1.1. Err - одна из ошибок Err* выше,
+// по ней вызывающий выбирает код ответа; Value - фрагмент, на котором разбор остановился.
+type ParseError struct {
+	Err   error
+	Value string
+}
+
+func (e *ParseError) Error() string {
+	if e.Value == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v: %q", e.Err, e.Value)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func parseError(err error, value string) error {
+	return &ParseError{Err: err, Value: value}
+}
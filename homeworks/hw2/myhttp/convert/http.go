@@ -1,30 +1,663 @@
 package convert
 
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 )
 
-// ParseRequest парсит HTTP запрос из потока байт
-func ParseRequest(r io.Reader) (*http.Request, error) {
-	// TODO: implement HTTP request parsing
-	panic("TODO: implement me")
+// ParseRequest парсит HTTP запрос из потока байт.
+// Если r - *bufio.Reader, чтение идет прямо из него и тело запроса читается ровно до своей
+// границы, поэтому на одном соединении можно разбирать запросы один за другим (keep-alive).
+// У chunked-запроса req.Trailer не nil: сразу в нем только ключи из заголовка Trailer,
+// а значения полей трейлера появляются, когда тело дочитано до EOF.
+// Все, что может по-разному понять другой парсер на пути запроса (Content-Length вместе
+// с Transfer-Encoding, повторный Content-Length, obs-fold и т.д.), отвергается с *ParseError.
+// Принимаются HTTP/1.1 и HTTP/1.0; у запроса HTTP/1.0 req.Close сброшен, только если клиент
+// явно попросил Connection: keep-alive.
+func ParseRequest(r io.Reader, opts ...ParseOption) (*http.Request, error) {
+	o := defaultParseOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	br := newBufioReader(r)
+	strict := o.strictLineEndings
+
+	// строка запроса и заголовки делят один лимит
+	limit := max(o.maxHeaderBytes, 0)
+	var line string
+	var err error
+	for {
+		if line, err = readLine(br, strict, limit); err != nil {
+			if errors.Is(err, ErrLineTooLong) {
+				return nil, parseError(ErrHeaderTooLarge, "")
+			}
+			return nil, err
+		}
+		if limit > 0 {
+			if limit -= len(line) + len("\r\n"); limit <= 0 {
+				return nil, parseError(ErrHeaderTooLarge, "")
+			}
+		}
+		// по RFC перед строкой запроса могут прийти пустые строки, их пропускаем
+		if line != "" {
+			break
+		}
+	}
+
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || !isToken(parts[0]) {
+		return nil, parseError(ErrMalformedRequestLine, line)
+	}
+	method, target, proto := parts[0], parts[1], parts[2]
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok || major != 1 || minor > 1 {
+		return nil, parseError(ErrUnsupportedVersion, proto)
+	}
+	var u *url.URL
+	switch {
+	case method == http.MethodConnect && !strings.HasPrefix(target, "/"):
+		// CONNECT адресует не ресурс, а host:port, к которому прокси открывает туннель
+		u = &url.URL{Host: target}
+	case target == "*":
+		// asterisk-form допустима только у OPTIONS и относится ко всему серверу (RFC 9112, 3.2.4)
+		if method != http.MethodOptions {
+			return nil, parseError(ErrMalformedRequestLine, target)
+		}
+		u = &url.URL{Path: "*"}
+	default:
+		if u, err = url.ParseRequestURI(target); err != nil {
+			return nil, parseError(ErrMalformedRequestLine, target)
+		}
+	}
+
+	header, err := readHeader(br, strict, limit)
+	if err != nil {
+		return nil, err
+	}
+	// без Host или с несколькими Host запрос разные узлы цепочки адресуют по-разному (RFC 9112, 3.2)
+	switch hosts := header.Values("Host"); {
+	case len(hosts) > 1:
+		return nil, parseError(ErrDuplicateHost, strings.Join(hosts, ", "))
+	case len(hosts) == 0 && minor > 0 && method != http.MethodConnect:
+		return nil, parseError(ErrMissingHost, "")
+	}
+
+	req := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      proto,
+		ProtoMajor: major,
+		ProtoMinor: minor,
+		Header:     header,
+		Host:       header.Get("Host"),
+		RequestURI: target,
+		Close:      shouldClose(major, minor, header),
+	}
+	// как и в net/http, Host переезжает из заголовков в отдельное поле
+	delete(req.Header, "Host")
+	if u.Host != "" {
+		req.Host = u.Host
+	}
+
+	if _, ok := header["Content-Length"]; ok && len(header.Values("Transfer-Encoding")) > 0 {
+		// прокси мог выбрать другой заголовок, и тогда граница запроса у нас с ним разная
+		return nil, parseError(ErrContentLengthWithTransferEncoding, "")
+	}
+	if minor == 0 && len(header.Values("Transfer-Encoding")) > 0 {
+		// в HTTP/1.0 Transfer-Encoding нет, и посредник мог найти границу запроса иначе (RFC 9112, 6.1)
+		return nil, parseError(ErrTransferEncodingHTTP10, header.Get("Transfer-Encoding"))
+	}
+	length, isChunked, err := readFraming(header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isChunked:
+		if req.Trailer, err = readTrailerKeys(header); err != nil {
+			return nil, err
+		}
+		req.TransferEncoding = []string{"chunked"}
+		req.ContentLength = -1
+		req.Body = io.NopCloser(newChunkedReader(br, req.Trailer, strict, o.maxHeaderBytes))
+	case length > 0:
+		req.ContentLength = length
+		req.Body = io.NopCloser(&fixedReader{r: br, n: length})
+	default:
+		// у запроса без Content-Length и Transfer-Encoding тела нет
+		req.Body = http.NoBody
+	}
+
+	return req, nil
 }
 
-// WriteRequest записывает HTTP запрос в поток байт
+// WriteRequest записывает HTTP запрос в поток байт.
+// Если задан req.Trailer, тело идет чанками, ключи трейлера объявляются в заголовке Trailer,
+// а значения берутся из req.Trailer после того, как тело отправлено целиком.
 func WriteRequest(w io.Writer, req *http.Request) error {
-	// TODO: implement HTTP request writing
-	panic("TODO: implement me")
+	if req.URL == nil {
+		return errors.New("request URL is nil")
+	}
+	return writeRequest(w, req, req.URL.RequestURI())
+}
+
+// WriteProxyRequest записывает запрос для HTTP-прокси: в строке запроса вместо пути
+// указывается абсолютный URL (absolute-form), чтобы прокси знал, куда его переслать
+func WriteProxyRequest(w io.Writer, req *http.Request) error {
+	if req.URL == nil {
+		return errors.New("request URL is nil")
+	}
+	if req.URL.Scheme == "" || req.URL.Host == "" {
+		return fmt.Errorf("proxy request needs an absolute URL, got %q", req.URL)
+	}
+	return writeRequest(w, req, req.URL.Scheme+"://"+req.URL.Host+req.URL.RequestURI())
 }
 
-// ParseResponse парсит HTTP ответ из потока байт
+func writeRequest(w io.Writer, req *http.Request, target string) error {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if host == "" {
+		return errors.New("request host is empty")
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	length, isChunked, err := writeFraming(req.Body, req.ContentLength, req.Header, req.TransferEncoding, req.Trailer)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if _, err := fmt.Fprintf(bw, "%s %s HTTP/1.1\r\n", method, target); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(bw, "Host: %s\r\n", sanitizeHeaderValue(host)); err != nil {
+		return err
+	}
+	if err := writeHeader(bw, req.Header, "Host", "Content-Length", "Transfer-Encoding", "Trailer"); err != nil {
+		return err
+	}
+	if req.Close && !HeaderHasToken(req.Header, "Connection", "close") {
+		if _, err := io.WriteString(bw, "Connection: close\r\n"); err != nil {
+			return err
+		}
+	}
+	switch {
+	case isChunked:
+		err = writeChunkedHeader(bw, req.Trailer)
+	case length > 0 || (!hasBody(req.Body) && methodExpectsBody(method)):
+		_, err = fmt.Fprintf(bw, "Content-Length: %d\r\n", length)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(bw, "\r\n"); err != nil {
+		return err
+	}
+	// как и net/http, сообщаем трассировке клиента о записанных заголовках
+	if trace := httptrace.ContextClientTrace(req.Context()); trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+
+	if hasBody(req.Body) {
+		if HeaderHasToken(req.Header, "Expect", "100-continue") {
+			// тело может ждать 100 Continue от сервера, поэтому заголовки отправляем сразу
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+		if err := writeBody(bw, req.Body, length, isChunked, req.Trailer); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ParseResponse парсит HTTP ответ из потока байт.
+// Как и ParseRequest, при передаче *bufio.Reader не читает ничего дальше границы тела ответа.
 func ParseResponse(r io.Reader) (*http.Response, error) {
-	// TODO: implement HTTP response parsing
-	panic("TODO: implement me")
+	br := newBufioReader(r)
+
+	line, err := readLine(br, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	// reason-phrase может быть пустой, а пробел перед ней - отсутствовать (RFC 9112, 4)
+	proto, status, ok := strings.Cut(line, " ")
+	if !ok {
+		return nil, parseError(ErrMalformedStatusLine, line)
+	}
+	code, _, _ := strings.Cut(status, " ")
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok || major != 1 {
+		return nil, parseError(ErrUnsupportedVersion, proto)
+	}
+	statusCode, err := strconv.Atoi(code)
+	if err != nil || len(code) != 3 || statusCode < 100 {
+		return nil, parseError(ErrMalformedStatusLine, line)
+	}
+
+	header, err := readHeader(br, false, defaultMaxHeaderBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Status:     status,
+		StatusCode: statusCode,
+		Proto:      proto,
+		ProtoMajor: major,
+		ProtoMinor: minor,
+		Header:     header,
+		Close:      shouldClose(major, minor, header),
+	}
+
+	if !BodyAllowedForStatus(statusCode) {
+		resp.Body = http.NoBody
+		return resp, nil
+	}
+
+	length, isChunked, err := readFraming(header)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case isChunked:
+		if resp.Trailer, err = readTrailerKeys(header); err != nil {
+			return nil, err
+		}
+		resp.TransferEncoding = []string{"chunked"}
+		resp.ContentLength = -1
+		resp.Body = io.NopCloser(newChunkedReader(br, resp.Trailer, false, defaultMaxHeaderBytes))
+	case length == 0:
+		resp.Body = http.NoBody
+	case length > 0:
+		resp.ContentLength = length
+		resp.Body = io.NopCloser(&fixedReader{r: br, n: length})
+	default:
+		// длина не указана - тело идет до закрытия соединения
+		resp.ContentLength = -1
+		resp.Close = true
+		resp.Body = io.NopCloser(br)
+	}
+
+	return resp, nil
 }
 
-// WriteResponse записывает HTTP ответ в поток байт
+// WriteResponse записывает HTTP ответ в поток байт.
+// Status пишется в статусную строку как есть, поэтому в нем ожидается только reason-phrase.
+// resp.Trailer отправляется так же, как req.Trailer в WriteRequest.
 func WriteResponse(w io.Writer, resp *http.Response) error {
-	// TODO: implement HTTP response writing
-	panic("TODO: implement me")
+	if resp.Body != nil {
+		defer resp.Body.Close()
+	}
+	if !hasBody(resp.Body) {
+		// без тела заголовки пишем как есть: так ответ на HEAD сохраняет Content-Length
+		return WriteResponseHeader(w, resp)
+	}
+
+	length, isChunked, err := writeFraming(resp.Body, resp.ContentLength, resp.Header, resp.TransferEncoding, resp.Trailer)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeStatusLine(bw, resp); err != nil {
+		return err
+	}
+	if err := writeHeader(bw, resp.Header, "Content-Length", "Transfer-Encoding", "Trailer"); err != nil {
+		return err
+	}
+	if isChunked {
+		err = writeChunkedHeader(bw, resp.Trailer)
+	} else {
+		_, err = fmt.Fprintf(bw, "Content-Length: %d\r\n", length)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(bw, "\r\n"); err != nil {
+		return err
+	}
+	if err := writeBody(bw, resp.Body, length, isChunked, resp.Trailer); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteResponseHeader записывает только статусную строку и заголовки ответа, без изменений.
+// Тело и описывающие его длину заголовки остаются на вызывающем - так пишутся потоковые ответы.
+func WriteResponseHeader(w io.Writer, resp *http.Response) error {
+	bw := bufio.NewWriter(w)
+	if err := writeStatusLine(bw, resp); err != nil {
+		return err
+	}
+	if err := writeHeader(bw, resp.Header); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(bw, "\r\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func writeStatusLine(w io.Writer, resp *http.Response) error {
+	proto := resp.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	status := resp.Status
+	if status == "" {
+		status = http.StatusText(resp.StatusCode)
+	}
+	_, err := fmt.Fprintf(w, "%s %d %s\r\n", proto, resp.StatusCode, status)
+	return err
+}
+
+func newBufioReader(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// readLine читает строку до \n и отрезает окончание строки. В строгом режиме строка обязана
+// заканчиваться на \r\n; limit > 0 ограничивает длину строки вместе с окончанием.
+// Пустой поток дает io.EOF, оборванная строка - io.ErrUnexpectedEOF.
+func readLine(br *bufio.Reader, strict bool, limit int) (string, error) {
+	var line []byte
+	for {
+		frag, err := br.ReadSlice('\n')
+		line = append(line, frag...)
+		if limit > 0 && len(line) > limit {
+			return "", parseError(ErrLineTooLong, "")
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		break
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	} else if strict {
+		return "", parseError(ErrBareLF, string(line))
+	}
+	return string(line), nil
+}
+
+// readHeader читает заголовки до пустой строки. limit > 0 ограничивает размер всех строк
+// вместе с окончаниями; если он превышен, возвращается ErrHeaderTooLarge.
+func readHeader(br *bufio.Reader, strict bool, limit int) (http.Header, error) {
+	header := make(http.Header)
+	remain := limit
+	for {
+		lineLimit := 0
+		if limit > 0 {
+			if remain <= 0 {
+				return nil, parseError(ErrHeaderTooLarge, "")
+			}
+			lineLimit = remain
+		}
+		line, err := readLine(br, strict, lineLimit)
+		if errors.Is(err, ErrLineTooLong) {
+			return nil, parseError(ErrHeaderTooLarge, "")
+		}
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		remain -= len(line) + len("\r\n")
+		if line == "" {
+			return header, nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// RFC 9112 разрешает серверу отвергнуть obs-fold, а склеивать строки небезопасно
+			return nil, parseError(ErrObsFold, line)
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, parseError(ErrMalformedHeader, line)
+		}
+		if !isToken(name) {
+			return nil, parseError(ErrInvalidHeaderName, name)
+		}
+		header.Add(http.CanonicalHeaderKey(name), strings.Trim(value, " \t"))
+	}
+}
+
+// writeHeader пишет заголовки в отсортированном порядке, пропуская exclude
+func writeHeader(w io.Writer, header http.Header, exclude ...string) error {
+	for _, key := range sortedKeys(header) {
+		if containsFold(exclude, key) {
+			continue
+		}
+		for _, value := range header[key] {
+			if _, err := fmt.Fprintf(w, "%s: %s\r\n", key, sanitizeHeaderValue(value)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readFraming определяет по заголовкам, как ограничено тело входящего сообщения.
+// length = -1 означает, что Content-Length не указан.
+func readFraming(header http.Header) (length int64, isChunked bool, err error) {
+	if te := header.Values("Transfer-Encoding"); len(te) > 0 {
+		if len(te) != 1 || !strings.EqualFold(strings.TrimSpace(te[0]), "chunked") {
+			return 0, false, parseError(ErrUnsupportedTransferEncoding, strings.Join(te, ", "))
+		}
+		// Transfer-Encoding важнее Content-Length, как и в net/http
+		header.Del("Transfer-Encoding")
+		header.Del("Content-Length")
+		return -1, true, nil
+	}
+
+	values, ok := header["Content-Length"]
+	if !ok {
+		return -1, false, nil
+	}
+	// повтор, даже с тем же значением, означает, что сообщение собирали из частей
+	if len(values) != 1 {
+		return 0, false, parseError(ErrInvalidContentLength, strings.Join(values, ", "))
+	}
+	cl := strings.TrimSpace(values[0])
+	if cl == "" || strings.Trim(cl, "0123456789") != "" {
+		return 0, false, parseError(ErrInvalidContentLength, values[0])
+	}
+	length, err = strconv.ParseInt(cl, 10, 64)
+	if err != nil {
+		return 0, false, parseError(ErrInvalidContentLength, values[0])
+	}
+	return length, false, nil
+}
+
+// writeFraming выбирает способ передачи исходящего тела: известную длину или chunked.
+// Длину берем из поля ContentLength, затем из заголовка, иначе отправляем чанками.
+// Трейлер можно передать только после чанков, поэтому с ним тело всегда идет chunked.
+func writeFraming(body io.Reader, contentLength int64, header http.Header, te []string, trailer http.Header) (length int64, isChunked bool, err error) {
+	if !hasBody(body) {
+		if contentLength > 0 {
+			return 0, false, fmt.Errorf("ContentLength=%d with empty body", contentLength)
+		}
+		return 0, false, nil
+	}
+	for key := range trailer {
+		if ForbiddenTrailerKey(key) {
+			return 0, false, fmt.Errorf("bad trailer key %q", key)
+		}
+	}
+	if containsFold(te, "chunked") || len(trailer) > 0 {
+		return -1, true, nil
+	}
+	if contentLength > 0 {
+		return contentLength, false, nil
+	}
+	if cl := header.Get("Content-Length"); cl != "" {
+		length, err := strconv.ParseInt(strings.TrimSpace(cl), 10, 64)
+		if err != nil || length < 0 {
+			return 0, false, fmt.Errorf("malformed Content-Length %q", cl)
+		}
+		return length, false, nil
+	}
+	return -1, true, nil
+}
+
+func writeBody(w io.Writer, body io.Reader, length int64, isChunked bool, trailer http.Header) error {
+	if isChunked {
+		cw := &chunkedWriter{w: w, trailer: trailer}
+		if _, err := io.Copy(flushAfterWrite(cw, w), body); err != nil {
+			return err
+		}
+		return cw.Close()
+	}
+	// лишнее тело обрезаем по Content-Length, недостающее - ошибка
+	if _, err := io.CopyN(flushAfterWrite(w, w), body, length); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("body is shorter than Content-Length %d: %w", length, io.ErrUnexpectedEOF)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeChunkedHeader объявляет chunked-тело и ключи трейлера, который придет после него
+func writeChunkedHeader(w io.Writer, trailer http.Header) error {
+	if _, err := io.WriteString(w, "Transfer-Encoding: chunked\r\n"); err != nil {
+		return err
+	}
+	if len(trailer) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "Trailer: %s\r\n", strings.Join(sortedKeys(trailer), ", "))
+	return err
+}
+
+// readTrailerKeys забирает из заголовков объявление Trailer и возвращает трейлер с этими ключами
+// без значений, как это делает net/http
+func readTrailerKeys(header http.Header) (http.Header, error) {
+	trailer := make(http.Header)
+	for _, value := range header.Values("Trailer") {
+		for _, key := range strings.Split(value, ",") {
+			key = http.CanonicalHeaderKey(strings.TrimSpace(key))
+			if key == "" {
+				continue
+			}
+			if ForbiddenTrailerKey(key) {
+				return nil, parseError(ErrBadTrailerKey, key)
+			}
+			trailer[key] = nil
+		}
+	}
+	header.Del("Trailer")
+	return trailer, nil
+}
+
+// ForbiddenTrailerKey сообщает, что поле описывает само сообщение и в трейлере ему не место.
+// Пустое имя тоже запрещено: такое поле в трейлер не записать.
+func ForbiddenTrailerKey(key string) bool {
+	switch http.CanonicalHeaderKey(key) {
+	case "", "Content-Length", "Transfer-Encoding", "Trailer", "Host":
+		return true
+	}
+	return false
+}
+
+func hasBody(body io.Reader) bool {
+	return body != nil && body != http.NoBody
+}
+
+func methodExpectsBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// BodyAllowedForStatus сообщает, может ли у ответа с таким кодом быть тело (RFC 9112, 6.3)
+func BodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// shouldClose сообщает, нужно ли закрыть соединение после этого сообщения
+func shouldClose(major, minor int, header http.Header) bool {
+	if major < 1 || (major == 1 && minor == 0) {
+		return !HeaderHasToken(header, "Connection", "keep-alive")
+	}
+	return HeaderHasToken(header, "Connection", "close")
+}
+
+// HeaderHasToken проверяет, есть ли token в списке значений заголовка через запятую,
+// например close в Connection или 100-continue в Expect. Регистр не учитывается.
+func HeaderHasToken(header http.Header, key, token string) bool {
+	for _, value := range header.Values(key) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isToken проверяет, что s - token из RFC 9110: так устроены метод и имя заголовка
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func sanitizeHeaderValue(v string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(v)
+}
+
+func sortedKeys(header http.Header) []string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
 }
@@ -1,14 +1,19 @@
 package convert
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestParseRequest(t *testing.T) {
@@ -55,6 +60,18 @@ func TestParseRequest(t *testing.T) {
 				}
 			},
 		},
+		{
+			name: "success: OPTIONS in asterisk-form",
+			input: "OPTIONS * HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, http.MethodOptions, req.Method)
+				assert.Equal(t, "*", req.URL.Path)
+				assert.Equal(t, "*", req.RequestURI)
+			},
+		},
 		{
 			name: "success: request with query parameters",
 			input: "GET /search?q=golang&page=1 HTTP/1.1\r\n" +
@@ -65,6 +82,76 @@ func TestParseRequest(t *testing.T) {
 				assert.Equal(t, "q=golang&page=1", req.URL.RawQuery)
 			},
 		},
+		{
+			name: "success: chunked request body",
+			input: "POST /upload HTTP/1.1\r\n" +
+				"Host: example.com\r\n" +
+				"Transfer-Encoding: chunked\r\n" +
+				"\r\n" +
+				"4\r\nWiki\r\n" +
+				"6\r\npedia \r\n" +
+				"0\r\n" +
+				"\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, int64(-1), req.ContentLength)
+				assert.Equal(t, []string{"chunked"}, req.TransferEncoding)
+				body, err := io.ReadAll(req.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "Wikipedia ", string(body))
+			},
+		},
+		{
+			name: "success: absolute-form target from proxy client",
+			input: "GET http://example.com:8080/path?q=1 HTTP/1.1\r\n" +
+				"Host: example.com:8080\r\n" +
+				"\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, "http", req.URL.Scheme)
+				assert.Equal(t, "/path", req.URL.Path)
+				assert.Equal(t, "example.com:8080", req.Host)
+			},
+		},
+		{
+			name: "success: CONNECT with authority-form target",
+			input: "CONNECT example.com:443 HTTP/1.1\r\n" +
+				"Host: example.com:443\r\n" +
+				"\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, http.MethodConnect, req.Method)
+				assert.Equal(t, "example.com:443", req.URL.Host)
+				assert.Equal(t, "example.com:443", req.Host)
+				assert.Equal(t, http.NoBody, req.Body)
+			},
+		},
+		{
+			name:    "success: HTTP/1.0 closes by default",
+			input:   "GET / HTTP/1.0\r\n\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.Equal(t, "HTTP/1.0", req.Proto)
+				assert.Equal(t, 0, req.ProtoMinor)
+				assert.Empty(t, req.Host)
+				assert.True(t, req.Close)
+			},
+		},
+		{
+			name: "success: HTTP/1.0 keep-alive",
+			input: "POST /submit HTTP/1.0\r\n" +
+				"Connection: keep-alive\r\n" +
+				"Content-Length: 2\r\n" +
+				"\r\n" +
+				"ok",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, req *http.Request) {
+				assert.False(t, req.Close)
+				body, err := io.ReadAll(req.Body)
+				require.NoError(t, err)
+				assert.Equal(t, "ok", string(body))
+			},
+		},
 		{
 			name: "error: invalid request line: too much",
 			input: "GET / HTTP/1.1 extra\r\n" +
@@ -356,13 +443,41 @@ func TestParseResponse(t *testing.T) {
 			},
 		},
 		{
-			name: "invalid status line",
+			name: "status line without reason phrase",
 			input: "HTTP/1.1 200\r\n" +
+				"Content-Length: 2\r\n" +
+				"\r\n" +
+				"ok",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, 200, resp.StatusCode)
+				assert.Equal(t, "200", resp.Status)
+			},
+		},
+		{
+			name: "status line with empty reason phrase",
+			input: "HTTP/1.1 204 \r\n" +
+				"\r\n",
+			wantErr: assert.NoError,
+			check: func(t *testing.T, resp *http.Response) {
+				assert.Equal(t, 204, resp.StatusCode)
+			},
+		},
+		{
+			name: "invalid status line",
+			input: "HTTP/1.1 OK 200\r\n" +
 				"Content-Type: text/plain\r\n" +
 				"\r\n",
 			wantErr: assert.Error,
 			check:   nil,
 		},
+		{
+			name: "status line without status code",
+			input: "HTTP/1.1\r\n" +
+				"\r\n",
+			wantErr: assert.Error,
+			check:   nil,
+		},
 	}
 
 	for _, tt := range tests {
@@ -551,3 +666,489 @@ func TestResponseRoundTrip(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteProxyRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  *http.Request
+		wantLine string
+		wantHost string
+		wantErr  assert.ErrorAssertionFunc
+	}{
+		{
+			name: "success: absolute-form target",
+			request: &http.Request{
+				Method: http.MethodGet,
+				URL:    &url.URL{Scheme: "http", Host: "example.com:8080", Path: "/path", RawQuery: "q=1", Fragment: "top"},
+			},
+			wantLine: "GET http://example.com:8080/path?q=1 HTTP/1.1",
+			wantHost: "example.com:8080",
+			wantErr:  assert.NoError,
+		},
+		{
+			name: "success: Host header differs from URL",
+			request: &http.Request{
+				URL:  &url.URL{Scheme: "http", Host: "10.0.0.1", Path: "/"},
+				Host: "example.com",
+			},
+			wantLine: "GET http://10.0.0.1/ HTTP/1.1",
+			wantHost: "example.com",
+			wantErr:  assert.NoError,
+		},
+		{
+			name: "error: relative URL",
+			request: &http.Request{
+				URL:  &url.URL{Path: "/"},
+				Host: "example.com",
+			},
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			err := WriteProxyRequest(&buf, tt.request)
+			tt.wantErr(t, err)
+			if err != nil {
+				return
+			}
+			line, headers, _ := splitParts(t, buf.String())
+			assert.Equal(t, tt.wantLine, line)
+			assert.Equal(t, tt.wantHost, headers["Host"])
+		})
+	}
+}
+
+func TestParseRequest_KeepAlive(t *testing.T) {
+	input := "POST /first HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Content-Length: 5\r\n" +
+		"\r\n" +
+		"hello" +
+		"POST /second HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Transfer-Encoding: chunked\r\n" +
+		"\r\n" +
+		"5\r\nworld\r\n0\r\n\r\n" +
+		"GET /third HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Connection: close\r\n" +
+		"\r\n"
+
+	br := bufio.NewReader(strings.NewReader(input))
+	for _, want := range []struct {
+		path  string
+		body  string
+		close bool
+	}{
+		{path: "/first", body: "hello"},
+		{path: "/second", body: "world"},
+		{path: "/third", close: true},
+	} {
+		req, err := ParseRequest(br)
+		assert.NoError(t, err)
+		assert.Equal(t, want.path, req.URL.Path)
+		assert.Equal(t, want.close, req.Close)
+		body, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, want.body, string(body))
+	}
+
+	_, err := ParseRequest(br)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestContentEncoding(t *testing.T) {
+	const payload = `{"greeting": "Hello, World!"}`
+	tests := []struct {
+		name     string
+		encoding string
+		encode   func(t *testing.T, w io.Writer) // nil - сжимаем через NewEncoder
+		wantErr  bool
+	}{
+		{name: "success: gzip", encoding: "gzip"},
+		{name: "success: x-gzip", encoding: "x-gzip"},
+		{name: "success: deflate as zlib stream", encoding: "deflate"},
+		{
+			name:     "success: deflate as raw stream",
+			encoding: "deflate",
+			encode: func(t *testing.T, w io.Writer) {
+				fw, err := flate.NewWriter(w, flate.DefaultCompression)
+				require.NoError(t, err)
+				_, err = io.WriteString(fw, payload)
+				require.NoError(t, err)
+				require.NoError(t, fw.Close())
+			},
+		},
+		{
+			name:     "error: corrupted gzip",
+			encoding: "gzip",
+			encode: func(t *testing.T, w io.Writer) {
+				_, err := io.WriteString(w, "not gzip at all")
+				require.NoError(t, err)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var compressed bytes.Buffer
+			if tt.encode != nil {
+				tt.encode(t, &compressed)
+			} else {
+				enc, err := NewEncoder(&compressed, tt.encoding)
+				require.NoError(t, err)
+				_, err = io.WriteString(enc, payload)
+				require.NoError(t, err)
+				require.NoError(t, enc.Close())
+			}
+
+			body, err := NewDecodingReader(io.NopCloser(&compressed), tt.encoding)
+			require.NoError(t, err)
+			got, err := io.ReadAll(body)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, payload, string(got))
+		})
+	}
+
+	_, err := NewEncoder(io.Discard, "br")
+	assert.Error(t, err)
+	_, err = NewDecodingReader(io.NopCloser(strings.NewReader("")), "br")
+	assert.Error(t, err)
+}
+
+func TestTrailers(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		wantBody    string
+		wantBefore  http.Header
+		wantTrailer http.Header
+		wantErr     assert.ErrorAssertionFunc
+	}{
+		{
+			name: "success: announced trailer",
+			raw: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nTrailer: x-checksum\r\n\r\n" +
+				"5\r\nhello\r\n0\r\nX-Checksum: abc\r\n\r\n",
+			wantBody:    "hello",
+			wantBefore:  http.Header{"X-Checksum": nil},
+			wantTrailer: http.Header{"X-Checksum": {"abc"}},
+			wantErr:     assert.NoError,
+		},
+		{
+			name: "success: unannounced trailer and forbidden fields dropped",
+			raw: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"5\r\nhello\r\n0\r\nGrpc-Status: 0\r\nContent-Length: 5\r\n\r\n",
+			wantBody:    "hello",
+			wantBefore:  http.Header{},
+			wantTrailer: http.Header{"Grpc-Status": {"0"}},
+			wantErr:     assert.NoError,
+		},
+		{
+			name: "error: forbidden announced key",
+			raw: "POST / HTTP/1.1\r\nHost: example.com\r\nTransfer-Encoding: chunked\r\nTrailer: Content-Length\r\n\r\n" +
+				"0\r\n\r\n",
+			wantErr: assert.Error,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseRequest(strings.NewReader(tt.raw))
+			tt.wantErr(t, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tt.wantBefore, req.Trailer)
+			assert.Empty(t, req.Header.Get("Trailer"))
+			body, err := io.ReadAll(req.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+			assert.Equal(t, tt.wantTrailer, req.Trailer)
+		})
+	}
+
+	t.Run("success: write and parse response trailer", func(t *testing.T) {
+		trailer := http.Header{"X-Checksum": nil}
+		body := &trailerFillingReader{r: strings.NewReader("hello"), fill: func() { trailer.Set("X-Checksum", "abc") }}
+		var buf bytes.Buffer
+		require.NoError(t, WriteResponse(&buf, &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": {"text/plain"}},
+			Body:          io.NopCloser(body),
+			ContentLength: 5,
+			Trailer:       trailer,
+		}))
+		assert.Contains(t, buf.String(), "Trailer: X-Checksum\r\n")
+		assert.Contains(t, buf.String(), "Transfer-Encoding: chunked\r\n")
+		assert.NotContains(t, buf.String(), "Content-Length")
+		assert.True(t, strings.HasSuffix(buf.String(), "0\r\nX-Checksum: abc\r\n\r\n"))
+
+		resp, err := ParseResponse(&buf)
+		require.NoError(t, err)
+		assert.Equal(t, http.Header{"X-Checksum": nil}, resp.Trailer)
+		got, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(got))
+		assert.Equal(t, "abc", resp.Trailer.Get("X-Checksum"))
+	})
+
+	t.Run("error: write forbidden trailer key", func(t *testing.T) {
+		err := WriteRequest(io.Discard, &http.Request{
+			Method:  http.MethodPost,
+			URL:     &url.URL{Path: "/"},
+			Host:    "example.com",
+			Body:    io.NopCloser(strings.NewReader("x")),
+			Trailer: http.Header{"Content-Length": {"1"}},
+		})
+		assert.Error(t, err)
+	})
+}
+
+// trailerFillingReader вызывает fill, когда тело прочитано: так значения трейлера
+// появляются только после отправки тела
+type trailerFillingReader struct {
+	r    io.Reader
+	fill func()
+}
+
+func (r *trailerFillingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err == io.EOF {
+		r.fill()
+	}
+	return n, err
+}
+
+func TestParseRequest_Smuggling(t *testing.T) {
+	const head = "POST / HTTP/1.1\r\nHost: example.com\r\n"
+
+	tests := []struct {
+		name    string
+		input   string
+		opts    []ParseOption
+		wantErr error
+	}{
+		{
+			name:    "error: Content-Length with Transfer-Encoding",
+			input:   head + "Content-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			wantErr: ErrContentLengthWithTransferEncoding,
+		},
+		{
+			name:    "error: duplicate Content-Length",
+			input:   head + "Content-Length: 5\r\nContent-Length: 5\r\n\r\nhello",
+			wantErr: ErrInvalidContentLength,
+		},
+		{
+			name:    "error: mismatched Content-Length list",
+			input:   head + "Content-Length: 5, 6\r\n\r\nhello",
+			wantErr: ErrInvalidContentLength,
+		},
+		{
+			name:    "error: signed Content-Length",
+			input:   head + "Content-Length: +5\r\n\r\nhello",
+			wantErr: ErrInvalidContentLength,
+		},
+		{
+			name:    "error: obs-fold",
+			input:   head + "X-Long: first\r\n second\r\n\r\n",
+			wantErr: ErrObsFold,
+		},
+		{
+			name:    "error: whitespace before colon",
+			input:   head + "Content-Length : 5\r\n\r\nhello",
+			wantErr: ErrInvalidHeaderName,
+		},
+		{
+			name:    "error: separator in header name",
+			input:   head + "X(Test): 1\r\n\r\n",
+			wantErr: ErrInvalidHeaderName,
+		},
+		{
+			name:    "error: header line without colon",
+			input:   head + "X-Test\r\n\r\n",
+			wantErr: ErrMalformedHeader,
+		},
+		{
+			name:    "error: bare LF in strict mode",
+			input:   "GET / HTTP/1.1\nHost: example.com\n\n",
+			opts:    []ParseOption{WithStrictLineEndings()},
+			wantErr: ErrBareLF,
+		},
+		{
+			name:    "error: bare LF in chunk in strict mode",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n5\nhello\r\n0\r\n\r\n",
+			opts:    []ParseOption{WithStrictLineEndings()},
+			wantErr: ErrBareLF,
+		},
+		{
+			name:    "error: oversized chunk-size line",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n5;" + strings.Repeat("x", 5000) + "\r\nhello\r\n0\r\n\r\n",
+			wantErr: ErrLineTooLong,
+		},
+		{
+			name:    "error: oversized trailer line",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n0\r\nX-Big: " + strings.Repeat("x", defaultMaxHeaderBytes) + "\r\n\r\n",
+			wantErr: ErrHeaderTooLarge,
+		},
+		{
+			name:    "error: too many trailer fields",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n0\r\n" + strings.Repeat("X-Field: "+strings.Repeat("x", 1000)+"\r\n", defaultMaxHeaderBytes/1000) + "\r\n",
+			wantErr: ErrHeaderTooLarge,
+		},
+		{
+			name:    "error: headers exceed max header bytes",
+			input:   head + "X-Big: " + strings.Repeat("x", 2048) + "\r\n\r\n",
+			opts:    []ParseOption{WithMaxHeaderBytes(1024)},
+			wantErr: ErrHeaderTooLarge,
+		},
+		{
+			name:    "error: request line exceeds max header bytes",
+			input:   "GET /" + strings.Repeat("x", 2048) + " HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			opts:    []ParseOption{WithMaxHeaderBytes(1024)},
+			wantErr: ErrHeaderTooLarge,
+		},
+		{
+			name:    "error: trailer exceeds max header bytes",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n0\r\nX-Big: " + strings.Repeat("x", 2048) + "\r\n\r\n",
+			opts:    []ParseOption{WithMaxHeaderBytes(1024)},
+			wantErr: ErrHeaderTooLarge,
+		},
+		{
+			name:    "error: whitespace before chunk size",
+			input:   head + "Transfer-Encoding: chunked\r\n\r\n 5\r\nhello\r\n0\r\n\r\n",
+			wantErr: ErrMalformedChunk,
+		},
+		{
+			name:    "error: unsupported Transfer-Encoding",
+			input:   head + "Transfer-Encoding: gzip, chunked\r\n\r\n0\r\n\r\n",
+			wantErr: ErrUnsupportedTransferEncoding,
+		},
+		{
+			name:    "error: invalid method token",
+			input:   "G@T / HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			wantErr: ErrMalformedRequestLine,
+		},
+		{
+			name:    "error: Transfer-Encoding in HTTP/1.0",
+			input:   "POST / HTTP/1.0\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			wantErr: ErrTransferEncodingHTTP10,
+		},
+		{
+			name:    "error: missing Host in HTTP/1.1",
+			input:   "GET / HTTP/1.1\r\nAccept: */*\r\n\r\n",
+			wantErr: ErrMissingHost,
+		},
+		{
+			name:    "error: duplicate Host",
+			input:   "GET / HTTP/1.1\r\nHost: example.com\r\nHost: evil.com\r\n\r\n",
+			wantErr: ErrDuplicateHost,
+		},
+		{
+			name:    "error: asterisk-form with GET",
+			input:   "GET * HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			wantErr: ErrMalformedRequestLine,
+		},
+		{
+			name:    "error: HTTP/1.2 request line",
+			input:   "GET / HTTP/1.2\r\nHost: example.com\r\n\r\n",
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:    "error: HTTP/2 request line",
+			input:   "GET / HTTP/2.0\r\nHost: example.com\r\n\r\n",
+			wantErr: ErrUnsupportedVersion,
+		},
+		{
+			name:  "success: HTTP/1.0 without Host",
+			input: "GET / HTTP/1.0\r\n\r\n",
+		},
+		{
+			name:  "success: bare LF outside strict mode",
+			input: "POST / HTTP/1.1\nHost: example.com\nTransfer-Encoding: chunked\n\n5\nhello\n0\n\n",
+		},
+		{
+			name:  "success: trailer within max header bytes",
+			input: head + "Transfer-Encoding: chunked\r\n\r\n0\r\nX-Checksum: " + strings.Repeat("x", 512) + "\r\n\r\n",
+			opts:  []ParseOption{WithMaxHeaderBytes(1024)},
+		},
+		{
+			name:  "success: chunk extension with whitespace",
+			input: head + "Transfer-Encoding: chunked\r\n\r\n5 ;name=value\r\nhello\r\n0\r\n\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseRequest(strings.NewReader(tt.input), tt.opts...)
+			if err == nil {
+				// часть нарушений видна только при чтении тела
+				_, err = io.ReadAll(req.Body)
+			}
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.wantErr)
+			var perr *ParseError
+			assert.ErrorAs(t, err, &perr)
+		})
+	}
+}
+
+func TestParseRequest_Forms(t *testing.T) {
+	var mp bytes.Buffer
+	mw := multipart.NewWriter(&mp)
+	require.NoError(t, mw.WriteField("name", "gopher"))
+	part, err := mw.CreateFormFile("file", "a.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("content"))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	tests := []struct {
+		name  string
+		input string
+		check func(t *testing.T, req *http.Request)
+	}{
+		{
+			name: "success: urlencoded body and query",
+			input: "POST /?q=1 HTTP/1.1\r\nHost: example.com\r\n" +
+				"Content-Type: application/x-www-form-urlencoded\r\nContent-Length: 11\r\n\r\nname=gopher",
+			check: func(t *testing.T, req *http.Request) {
+				require.NoError(t, req.ParseForm())
+				assert.Equal(t, "gopher", req.PostFormValue("name"))
+				assert.Equal(t, "1", req.FormValue("q"))
+			},
+		},
+		{
+			name: "success: chunked multipart body",
+			input: fmt.Sprintf("POST / HTTP/1.1\r\nHost: example.com\r\nContent-Type: %s\r\n"+
+				"Transfer-Encoding: chunked\r\n\r\n%x\r\n%s\r\n0\r\n\r\n", mw.FormDataContentType(), mp.Len(), mp.String()),
+			check: func(t *testing.T, req *http.Request) {
+				f, h, err := req.FormFile("file")
+				require.NoError(t, err)
+				defer f.Close()
+				body, err := io.ReadAll(f)
+				require.NoError(t, err)
+				assert.Equal(t, "a.txt", h.Filename)
+				assert.Equal(t, "content", string(body))
+				assert.Equal(t, "gopher", req.FormValue("name"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := ParseRequest(strings.NewReader(tt.input))
+			require.NoError(t, err)
+			tt.check(t, req)
+		})
+	}
+}
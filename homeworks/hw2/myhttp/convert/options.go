@@ -0,0 +1,33 @@
+package convert
+
+// defaultMaxHeaderBytes - ограничение на заголовки и трейлер по умолчанию, как в net/http
+const defaultMaxHeaderBytes = 1 << 20
+
+// ParseOption настраивает разбор входящего запроса в ParseRequest
+type ParseOption func(*parseOptions)
+
+type parseOptions struct {
+	strictLineEndings bool
+	maxHeaderBytes    int
+}
+
+func defaultParseOptions() parseOptions {
+	return parseOptions{maxHeaderBytes: defaultMaxHeaderBytes}
+}
+
+// WithStrictLineEndings требует, чтобы все строки запроса, включая строки чанков и трейлера,
+// заканчивались на \r\n. Без него одиночный \n принимается как конец строки, как в net/http.
+func WithStrictLineEndings() ParseOption {
+	return func(o *parseOptions) {
+		o.strictLineEndings = true
+	}
+}
+
+// WithMaxHeaderBytes ограничивает размер строки запроса вместе с заголовками и, отдельно, трейлера
+// chunked-тела. Превышение дает ErrHeaderTooLarge: для заголовков - из ParseRequest, для трейлера -
+// при чтении тела. По умолчанию 1 МБ, 0 и меньше - без ограничения.
+func WithMaxHeaderBytes(n int) ParseOption {
+	return func(o *parseOptions) {
+		o.maxHeaderBytes = n
+	}
+}
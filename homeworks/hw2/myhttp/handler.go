@@ -1,9 +1,62 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
 )
 
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+// myHandler - greet за проверками метода и авторизации
+var myHandler = router.Chain(
+	router.AllowMethods(http.MethodGet, http.MethodPost),
+	router.RequireAuthorization,
+)(http.HandlerFunc(greet))
+
 func MyHandler(rw http.ResponseWriter, r *http.Request) {
-	panic("TODO: implement me")
+	myHandler.ServeHTTP(rw, r)
+}
+
+// greet отвечает приветствием: на GET - текстом по параметру name, на POST - JSON по JSON
+func greet(rw http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(rw, "name is required", http.StatusBadRequest)
+			return
+		}
+		rw.Header().Set("Content-Type", "text/plain")
+		rw.Header().Set("X-Custom-Result", "success")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprintf(rw, "Hello, %s!", name)
+		return
+	}
+
+	var in greetRequest
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		http.Error(rw, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if in.Name == "" {
+		http.Error(rw, "name is required", http.StatusBadRequest)
+		return
+	}
+	out, err := json.Marshal(greetResponse{Greeting: fmt.Sprintf("Hello, %s!", in.Name)})
+	if err != nil {
+		http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.Header().Set("X-Custom-Result", "success")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = rw.Write(out)
 }
@@ -9,6 +9,7 @@ import (
 	"os"
 
 	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
 	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
 )
 
@@ -22,8 +23,9 @@ func main() {
 
 	go func() {
 		fmt.Println("Server started at port", port)
-		http.HandleFunc("/test", MyHandler)
-		err := myServer.ListenAndServe(":"+port, nil)
+		r := router.New()
+		r.HandleFunc("/test", MyHandler)
+		err := myServer.ListenAndServe(":"+port, r)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -2,16 +2,17 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"testing"
-	"time"
 
-	"github.com/phayes/freeport"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
 	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
 )
 
@@ -140,30 +141,25 @@ func TestMyServerHandlerClient(t *testing.T) {
 			},
 		},
 	}
-	http.HandleFunc("/myhandler", MyHandler)
+	mux := router.New()
+	mux.HandleFunc("/myhandler", MyHandler)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			srv := server.New()
 
-			var err error
-			port := defaultPort
-			if port == 0 {
-				port, err = freeport.GetFreePort()
-				require.NoError(t, err)
-			}
-			addr := fmt.Sprintf("localhost:%v", port)
+			// порт занимаем заранее: к моменту запуска сервера он уже принимает соединения
+			l, err := net.Listen("tcp", fmt.Sprintf("localhost:%v", defaultPort))
+			require.NoError(t, err)
+			addr := l.Addr().String()
 
 			go func() {
-				err := srv.ListenAndServe(addr, nil)
-				if err != nil {
+				err := srv.Serve(l, mux)
+				if err != nil && !errors.Is(err, http.ErrServerClosed) {
 					log.Println("server error", err)
 				}
 			}()
 			defer srv.Close()
 
-			// ждём пока сервер поднимется
-			time.Sleep(time.Millisecond * 100)
-
 			req := tt.getRequest(addr)
 			c := client.New()
 			resp, err := c.Do(req)
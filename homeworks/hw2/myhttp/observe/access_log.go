@@ -0,0 +1,34 @@
+// Package observe - готовые middleware для наблюдения за HTTP-сервером: журнал запросов
+// в log/slog и метрики OpenTelemetry. Они работают с любым сервером, в том числе с myhttp
+// и net/http, и подключаются через router.New, router.Chain или Router.Use.
+package observe
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
+)
+
+// AccessLog пишет в logger строку "http request" на каждый обработанный запрос: method, path,
+// status, bytes (размер тела ответа), duration и remote_addr. Запись идет с контекстом запроса,
+// поэтому обработчик slog с поддержкой трассировки (например, otelslog) добавит к ней trace_id.
+func AccessLog(logger *slog.Logger) router.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+
+			logger.LogAttrs(r.Context(), slog.LevelInfo, "http request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.statusCode()),
+				slog.Int64("bytes", rec.written),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		})
+	}
+}
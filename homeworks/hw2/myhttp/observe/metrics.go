@@ -0,0 +1,110 @@
+package observe
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
+)
+
+// instrumentationName - имя Meter, под которым публикуются метрики
+const instrumentationName = "github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/observe"
+
+// durationBuckets - границы гистограммы длительности из семантических соглашений OpenTelemetry
+var durationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10}
+
+// Metrics возвращает middleware, которая записывает метрики запросов через mp, например
+// otel.GetMeterProvider(); в Prometheus их можно отдавать через его экспортер OpenTelemetry.
+// Имена и атрибуты - по семантическим соглашениям для HTTP-сервера:
+//   - http.server.request.count - число обработанных запросов;
+//   - http.server.request.duration - гистограмма длительности в секундах;
+//   - http.server.active_requests - сколько запросов обрабатывается прямо сейчас.
+//
+// Атрибуты: http.request.method, http.response.status_code, url.scheme, network.protocol.version
+// и http.route - шаблон маршрута router.Router или http.ServeMux, а не сам путь, чтобы число
+// временных рядов не росло с каждым новым URL.
+func Metrics(mp metric.MeterProvider) (router.Middleware, error) {
+	meter := mp.Meter(instrumentationName)
+	requests, err := meter.Int64Counter("http.server.request.count",
+		metric.WithDescription("Number of HTTP server requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests."),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(durationBuckets...))
+	if err != nil {
+		return nil, err
+	}
+	active, err := meter.Int64UpDownCounter("http.server.active_requests",
+		metric.WithDescription("Number of active HTTP server requests."),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			attrs := []attribute.KeyValue{
+				attribute.String("http.request.method", methodAttr(r.Method)),
+				attribute.String("url.scheme", schemeAttr(r)),
+			}
+			activeAttrs := metric.WithAttributeSet(attribute.NewSet(attrs...))
+			active.Add(ctx, 1, activeAttrs)
+			// счетчик активных запросов уменьшается, даже если обработчик запаниковал
+			defer active.Add(ctx, -1, activeAttrs)
+
+			start := time.Now()
+			rec := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			elapsed := time.Since(start)
+
+			attrs = append(attrs,
+				attribute.Int("http.response.status_code", rec.statusCode()),
+				attribute.String("network.protocol.version", fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)),
+			)
+			// Pattern заполняет маршрутизатор, поэтому смотрим его уже после обработчика
+			if route := routeAttr(r.Pattern); route != "" {
+				attrs = append(attrs, attribute.String("http.route", route))
+			}
+			set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+			requests.Add(ctx, 1, set)
+			duration.Record(ctx, elapsed.Seconds(), set)
+		})
+	}, nil
+}
+
+// methodAttr возвращает метод для атрибута. Произвольные методы сводятся к _OTHER,
+// иначе клиент может породить сколько угодно временных рядов.
+func methodAttr(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "_OTHER"
+	}
+}
+
+func schemeAttr(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// routeAttr оставляет от шаблона маршрута только путь: "GET /users/{id}" - "/users/{id}"
+func routeAttr(pattern string) string {
+	if i := strings.IndexByte(pattern, '/'); i >= 0 {
+		return pattern[i:]
+	}
+	return ""
+}
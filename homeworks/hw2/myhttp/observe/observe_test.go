@@ -0,0 +1,311 @@
+package observe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/router"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
+)
+
+// syncBuffer - буфер для журнала, в который пишут обработчики из разных соединений
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newRouter собирает маршруты, на которых проверяются middleware
+func newRouter(middlewares ...router.Middleware) *router.Router {
+	r := router.New(middlewares...)
+	r.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "user %s", req.PathValue("id"))
+	})
+	r.HandleFunc("POST /users", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	r.HandleFunc("GET /stream", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, "part1 ")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "part2")
+	})
+	r.HandleFunc("GET /fail", func(w http.ResponseWriter, req *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+	return r
+}
+
+// startServer запускает myhttp-сервер с handler и возвращает его адрес
+func startServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	srv := server.New()
+	go func() {
+		if err := srv.Serve(l, handler); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("server error", err)
+		}
+	}()
+	t.Cleanup(func() { _ = srv.Close() })
+	return l.Addr().String()
+}
+
+func doRequest(t *testing.T, c client.HTTPClient, method, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, url, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	return resp
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf syncBuffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	addr := startServer(t, newRouter(AccessLog(logger)))
+	c := client.New()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+		wantBytes  int
+	}{
+		{
+			name:       "success: body written",
+			method:     http.MethodGet,
+			path:       "/users/42",
+			wantStatus: http.StatusOK,
+			wantBytes:  len("user 42"),
+		},
+		{
+			name:       "success: status without body",
+			method:     http.MethodPost,
+			path:       "/users",
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "success: streamed response",
+			method:     http.MethodGet,
+			path:       "/stream",
+			wantStatus: http.StatusOK,
+			wantBytes:  len("part1 part2"),
+		},
+		{
+			name:       "success: handler error",
+			method:     http.MethodGet,
+			path:       "/fail",
+			wantStatus: http.StatusInternalServerError,
+			wantBytes:  len("boom\n"),
+		},
+		{
+			name:       "success: no route",
+			method:     http.MethodGet,
+			path:       "/missing",
+			wantStatus: http.StatusNotFound,
+			wantBytes:  len("404 page not found\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(buf.String())
+			resp := doRequest(t, c, tt.method, "http://"+addr+tt.path)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+
+			// строка журнала пишется после ответа, поэтому может появиться чуть позже
+			var line string
+			require.Eventually(t, func() bool {
+				line = strings.TrimSpace(buf.String()[before:])
+				return line != ""
+			}, time.Second, 5*time.Millisecond)
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			assert.Equal(t, "INFO", entry["level"])
+			assert.Equal(t, "http request", entry["msg"])
+			assert.Equal(t, tt.method, entry["method"])
+			assert.Equal(t, tt.path, entry["path"])
+			assert.EqualValues(t, tt.wantStatus, entry["status"])
+			assert.EqualValues(t, tt.wantBytes, entry["bytes"])
+			assert.Contains(t, entry, "duration")
+			assert.True(t, strings.HasPrefix(entry["remote_addr"].(string), "127.0.0.1:"))
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	metrics, err := Metrics(mp)
+	require.NoError(t, err)
+	addr := startServer(t, newRouter(metrics))
+	c := client.New()
+
+	doRequest(t, c, http.MethodGet, "http://"+addr+"/users/1")
+	doRequest(t, c, http.MethodGet, "http://"+addr+"/users/2")
+	doRequest(t, c, http.MethodPost, "http://"+addr+"/users")
+	doRequest(t, c, http.MethodGet, "http://"+addr+"/fail")
+	doRequest(t, c, "PURGE", "http://"+addr+"/users/1")
+
+	var rm metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &rm))
+	require.Len(t, rm.ScopeMetrics, 1)
+	assert.Equal(t, instrumentationName, rm.ScopeMetrics[0].Scope.Name)
+	byName := make(map[string]metricdata.Metrics)
+	for _, m := range rm.ScopeMetrics[0].Metrics {
+		byName[m.Name] = m
+	}
+
+	base := func(method string, status int, route string) attribute.Set {
+		attrs := []attribute.KeyValue{
+			attribute.String("http.request.method", method),
+			attribute.String("url.scheme", "http"),
+			attribute.Int("http.response.status_code", status),
+			attribute.String("network.protocol.version", "1.1"),
+		}
+		if route != "" {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+		return attribute.NewSet(attrs...)
+	}
+	wantCounts := map[attribute.Set]int64{
+		base(http.MethodGet, http.StatusOK, "/users/{id}"):            2,
+		base(http.MethodPost, http.StatusCreated, "/users"):           1,
+		base(http.MethodGet, http.StatusInternalServerError, "/fail"): 1,
+		base("_OTHER", http.StatusMethodNotAllowed, ""):               1,
+	}
+
+	t.Run("request count", func(t *testing.T) {
+		sum, ok := byName["http.server.request.count"].Data.(metricdata.Sum[int64])
+		require.True(t, ok)
+		assert.True(t, sum.IsMonotonic)
+		got := make(map[attribute.Set]int64)
+		for _, dp := range sum.DataPoints {
+			got[dp.Attributes] = dp.Value
+		}
+		assert.Equal(t, wantCounts, got)
+	})
+
+	t.Run("request duration", func(t *testing.T) {
+		m := byName["http.server.request.duration"]
+		assert.Equal(t, "s", m.Unit)
+		hist, ok := m.Data.(metricdata.Histogram[float64])
+		require.True(t, ok)
+		got := make(map[attribute.Set]int64)
+		for _, dp := range hist.DataPoints {
+			got[dp.Attributes] = int64(dp.Count)
+			assert.Equal(t, durationBuckets, dp.Bounds)
+		}
+		assert.Equal(t, wantCounts, got)
+	})
+
+	t.Run("active requests", func(t *testing.T) {
+		sum, ok := byName["http.server.active_requests"].Data.(metricdata.Sum[int64])
+		require.True(t, ok)
+		assert.False(t, sum.IsMonotonic)
+		require.NotEmpty(t, sum.DataPoints)
+		for _, dp := range sum.DataPoints {
+			assert.Zero(t, dp.Value)
+		}
+	})
+}
+
+func TestResponseRecorder(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		wantStatus  int
+		wantWritten int64
+		wantFlushed bool
+	}{
+		{
+			name:       "success: nothing written means 200",
+			handler:    func(w http.ResponseWriter, r *http.Request) {},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "success: first status wins",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+				w.WriteHeader(http.StatusTeapot)
+				_, _ = io.WriteString(w, "ok")
+			},
+			wantStatus:  http.StatusAccepted,
+			wantWritten: 2,
+		},
+		{
+			name: "success: informational status skipped",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name: "success: flush through response controller",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "chunk")
+				require.NoError(t, http.NewResponseController(w).Flush())
+			},
+			wantStatus:  http.StatusOK,
+			wantWritten: 5,
+			wantFlushed: true,
+		},
+		{
+			name: "error: hijack not supported by underlying writer",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _, err := w.(http.Hijacker).Hijack()
+				assert.ErrorIs(t, err, http.ErrNotSupported)
+			},
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rec := &responseRecorder{ResponseWriter: w}
+			tt.handler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, tt.wantStatus, rec.statusCode())
+			assert.Equal(t, tt.wantWritten, rec.written)
+			assert.Equal(t, tt.wantFlushed, w.Flushed)
+		})
+	}
+}
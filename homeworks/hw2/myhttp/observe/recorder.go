@@ -0,0 +1,63 @@
+package observe
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+)
+
+// responseRecorder пропускает ответ дальше, запоминая его код и размер тела
+type responseRecorder struct {
+	http.ResponseWriter
+	status   int
+	written  int64
+	hijacked bool
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	// 1xx - промежуточные ответы, окончательный код придет следом
+	if r.status == 0 && code >= 200 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.written += int64(n)
+	return n, err
+}
+
+// Flush и Hijack нужны обработчикам, которые проверяют http.Flusher и http.Hijacker напрямую,
+// а не через http.ResponseController
+func (r *responseRecorder) Flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	_ = http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, buf, err := http.NewResponseController(r.ResponseWriter).Hijack()
+	if err == nil {
+		r.hijacked = true
+	}
+	return conn, buf, err
+}
+
+// Unwrap дает http.ResponseController добраться до исходного writer'а
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// statusCode возвращает код ответа. Обработчик, который ничего не записал, ответил 200,
+// а у забранного через Hijack соединения кода нет - 0.
+func (r *responseRecorder) statusCode() int {
+	if r.status == 0 && !r.hijacked {
+		return http.StatusOK
+	}
+	return r.status
+}
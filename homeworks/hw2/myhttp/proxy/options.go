@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"time"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+)
+
+const (
+	// defaultMaxFails и defaultFailTimeout - как max_fails и fail_timeout в nginx
+	defaultMaxFails    = 1
+	defaultFailTimeout = 10 * time.Second
+)
+
+// Option настраивает прокси, создаваемый через New
+type Option func(*options)
+
+type options struct {
+	client      client.HTTPClient
+	maxFails    int
+	failTimeout time.Duration
+}
+
+func defaultOptions() options {
+	return options{
+		maxFails:    defaultMaxFails,
+		failTimeout: defaultFailTimeout,
+	}
+}
+
+// WithClient задает клиент, которым прокси ходит в upstream'ы. Клиент не должен сам идти
+// по редиректам, подставлять cookie и распаковывать тело: ответы upstream'а прокси отдает как есть.
+// По умолчанию используется client.New с отключенными редиректами и сжатием.
+func WithClient(c client.HTTPClient) Option {
+	return func(o *options) {
+		o.client = c
+	}
+}
+
+// WithMaxFails задает, после скольких ошибок подряд upstream считается недоступным.
+// 0 и меньше, как max_fails=0 в nginx, отключает учет: upstream всегда остается в ротации.
+func WithMaxFails(n int) Option {
+	return func(o *options) {
+		o.maxFails = n
+	}
+}
+
+// WithFailTimeout задает, на сколько недоступный upstream исключается из ротации
+func WithFailTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.failTimeout = d
+	}
+}
@@ -0,0 +1,265 @@
+// Package proxy - обратный прокси поверх myhttp: принимает запросы на myhttp сервере
+// и пересылает их на upstream'ы через myhttp клиент.
+//
+//	p, err := proxy.New([]*url.URL{shortener, stats})
+//	if err != nil { ... }
+//	err = server.New().ListenAndServe(":8000", p)
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+)
+
+// copyBufferSize - каким куском тело ответа пересылается клиенту
+const copyBufferSize = 32 << 10
+
+// hopHeaders - hop-by-hop заголовки (RFC 9110, 7.6.1): они касаются только одного соединения
+// и дальше прокси не передаются
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// ReverseProxy пересылает каждый запрос на один из upstream'ов по кругу. Тела запроса
+// и ответа не буферизуются, а передаются по мере чтения.
+// Upstream, к которому не удалось подключиться, на время исключается из ротации, а запрос
+// без тела повторяется на следующем.
+type ReverseProxy struct {
+	opts     options
+	balancer *balancer
+}
+
+var _ http.Handler = (*ReverseProxy)(nil)
+
+// New создает прокси для upstream'ов с адресами вида http://host:port/base/path
+func New(targets []*url.URL, opts ...Option) (*ReverseProxy, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("no upstreams")
+	}
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.client == nil {
+		o.client = client.New(
+			client.WithCheckRedirect(func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			}),
+			// тело ответа пересылается как есть, сжатое или нет
+			client.WithDisableCompression(),
+		)
+	}
+
+	b := &balancer{}
+	for _, target := range targets {
+		if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("invalid upstream URL %q", target)
+		}
+		b.upstreams = append(b.upstreams, &upstream{url: target})
+	}
+	return &ReverseProxy{opts: o, balancer: b}, nil
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// тело запроса читается из соединения один раз, поэтому повторить можно только запрос без тела
+	bodyless := r.ContentLength == 0
+	for attempt := 1; ; attempt++ {
+		up := p.balancer.pick()
+		resp, err := p.opts.client.Do(p.outgoingRequest(r, up.url))
+		if err == nil {
+			up.markOK()
+			p.copyResponse(w, resp)
+			return
+		}
+		if r.Context().Err() != nil {
+			// запрос отменили на нашей стороне, upstream тут ни при чем
+			return
+		}
+
+		up.markFailed(p.opts.maxFails, p.opts.failTimeout)
+		// upstream мог успеть выполнить запрос, прежде чем оборвал соединение, поэтому на другой
+		// отправляем только идемпотентные запросы и те, что до upstream'а не дошли
+		retryable := bodyless && (client.IsIdempotent(r) || client.RequestNotSent(err))
+		if retryable && attempt < len(p.balancer.upstreams) {
+			continue
+		}
+		log.Printf("myhttp/proxy: %s %s: %v", r.Method, r.URL, err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+}
+
+// outgoingRequest собирает запрос к upstream'у из входящего
+func (p *ReverseProxy) outgoingRequest(r *http.Request, target *url.URL) *http.Request {
+	out := r.Clone(r.Context())
+	out.RequestURI = ""
+	out.Close = false
+	out.Host = ""
+	out.URL.Scheme = target.Scheme
+	out.URL.Host = target.Host
+	out.URL.Path, out.URL.RawPath = joinURLPath(target, r.URL)
+	if target.RawQuery == "" || r.URL.RawQuery == "" {
+		out.URL.RawQuery = target.RawQuery + r.URL.RawQuery
+	} else {
+		out.URL.RawQuery = target.RawQuery + "&" + r.URL.RawQuery
+	}
+	if r.ContentLength == 0 {
+		out.Body = nil
+	}
+
+	removeHopHeaders(out.Header)
+	setForwardedHeaders(out.Header, r)
+	return out
+}
+
+// copyResponse отдает клиенту ответ upstream'а, пересылая тело по мере чтения
+func (p *ReverseProxy) copyResponse(w http.ResponseWriter, resp *http.Response) {
+	defer resp.Body.Close()
+
+	removeHopHeaders(resp.Header)
+	for key, values := range resp.Header {
+		w.Header()[key] = values
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	flusher, _ := w.(http.Flusher)
+	if flusher != nil && resp.ContentLength < 0 {
+		// длина неизвестна - скорее всего, это поток, и клиенту пора увидеть заголовки
+		flusher.Flush()
+	}
+
+	buf := make([]byte, copyBufferSize)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				panic(http.ErrAbortHandler)
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// заголовки уже отправлены, сообщить об ошибке можно только оборвав соединение
+			log.Printf("myhttp/proxy: reading upstream body: %v", err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+}
+
+// removeHopHeaders удаляет hop-by-hop заголовки, включая перечисленные в Connection
+func removeHopHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// setForwardedHeaders сообщает upstream'у, кто и как на самом деле прислал запрос:
+// X-Forwarded-For/Host/Proto и стандартный Forwarded (RFC 7239)
+func setForwardedHeaders(header http.Header, r *http.Request) {
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err == nil {
+		forwardedFor := clientIP
+		if prior := header.Values("X-Forwarded-For"); len(prior) > 0 {
+			forwardedFor = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		header.Set("X-Forwarded-For", forwardedFor)
+	}
+	if header.Get("X-Forwarded-Host") == "" {
+		header.Set("X-Forwarded-Host", r.Host)
+	}
+	header.Set("X-Forwarded-Proto", proto)
+
+	var elem []string
+	if clientIP != "" {
+		node := clientIP
+		if strings.Contains(node, ":") {
+			node = "[" + node + "]"
+		}
+		elem = append(elem, "for="+quoteForwarded(node))
+	}
+	if r.Host != "" {
+		elem = append(elem, "host="+quoteForwarded(r.Host))
+	}
+	elem = append(elem, "proto="+proto)
+	header.Add("Forwarded", strings.Join(elem, ";"))
+}
+
+// quoteForwarded берет значение Forwarded в кавычки, если в нем есть символы не из token
+func quoteForwarded(v string) string {
+	for _, c := range v {
+		if !isTokenChar(c) {
+			return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+		}
+	}
+	return v
+}
+
+func isTokenChar(c rune) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	}
+	return strings.ContainsRune("!#$%&'*+-.^_`|~", c)
+}
+
+// joinURLPath склеивает пути, как httputil.ReverseProxy: если хоть один задан в экранированном
+// виде, экранирование сохраняется, иначе /a%2Fb дошел бы до upstream'а как /a/b
+func joinURLPath(a, b *url.URL) (path, rawPath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	apath, bpath := a.EscapedPath(), b.EscapedPath()
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
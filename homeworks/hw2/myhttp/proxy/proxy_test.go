@@ -0,0 +1,427 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/phayes/freeport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
+)
+
+func TestReverseProxy_Rewrite(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Upstream-Hop")
+		w.Header().Set("X-Upstream-Hop", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("X-Upstream", "1")
+		_, _ = fmt.Fprintf(w, "%s %s", r.Method, r.URL.RequestURI())
+		for _, name := range []string{"X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "Forwarded", "X-Client-Hop", "Proxy-Authorization"} {
+			_, _ = fmt.Fprintf(w, "\n%s=%s", name, strings.Join(r.Header.Values(name), ", "))
+		}
+		_, _ = fmt.Fprintf(w, "\nHost=%s", r.Host)
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL + "/api?key=1")
+	require.NoError(t, err)
+
+	p, err := New([]*url.URL{upstreamURL})
+	require.NoError(t, err)
+	addr := startProxy(t, p)
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/users?page=2", nil)
+	require.NoError(t, err)
+	req.Header.Set("Connection", "X-Client-Hop")
+	req.Header.Set("X-Client-Hop", "1")
+	req.Header.Set("Proxy-Authorization", "Basic secret")
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	resp, err := client.New().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, strings.Join([]string{
+		"GET /api/users?key=1&page=2",
+		"X-Forwarded-For=10.0.0.1, 127.0.0.1",
+		"X-Forwarded-Host=" + addr,
+		"X-Forwarded-Proto=http",
+		`Forwarded=for=127.0.0.1;host="` + addr + `";proto=http`,
+		"X-Client-Hop=",
+		"Proxy-Authorization=",
+		"Host=" + upstreamURL.Host,
+	}, "\n"), string(body))
+	assert.Equal(t, "1", resp.Header.Get("X-Upstream"))
+	assert.Empty(t, resp.Header.Get("X-Upstream-Hop"))
+	assert.Empty(t, resp.Header.Get("Keep-Alive"))
+}
+
+func TestReverseProxy_EscapedPath(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.RequestURI)
+	}))
+	defer upstream.Close()
+
+	tests := []struct {
+		name   string
+		target string
+		path   string
+		want   string
+	}{
+		{
+			name:   "success: escaped slash is kept",
+			target: upstream.URL,
+			path:   "/a%2Fb",
+			want:   "/a%2Fb",
+		},
+		{
+			name:   "success: escaped slash under target path",
+			target: upstream.URL + "/api/",
+			path:   "/a%2Fb",
+			want:   "/api/a%2Fb",
+		},
+		{
+			name:   "success: escaped target path",
+			target: upstream.URL + "/x%2Fy",
+			path:   "/users",
+			want:   "/x%2Fy/users",
+		},
+		{
+			name:   "success: plain paths",
+			target: upstream.URL + "/api",
+			path:   "/users",
+			want:   "/api/users",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := url.Parse(tt.target)
+			require.NoError(t, err)
+			p, err := New([]*url.URL{target})
+			require.NoError(t, err)
+			addr := startProxy(t, p)
+
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+tt.path, nil)
+			require.NoError(t, err)
+			resp, err := client.New().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(body))
+		})
+	}
+}
+
+func TestUpstream_MarkFailed(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxFails int
+		fails    int
+		wantDown bool
+	}{
+		{name: "success: stays up below max fails", maxFails: 3, fails: 2, wantDown: false},
+		{name: "success: goes down at max fails", maxFails: 3, fails: 3, wantDown: true},
+		{name: "success: zero disables accounting", maxFails: 0, fails: 5, wantDown: false},
+		{name: "success: negative disables accounting", maxFails: -1, fails: 5, wantDown: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := &upstream{}
+			for range tt.fails {
+				u.markFailed(tt.maxFails, time.Minute)
+			}
+			assert.Equal(t, tt.wantDown, !u.available(time.Now()))
+		})
+	}
+}
+
+func TestReverseProxy_Streaming(t *testing.T) {
+	gotFirst := make(chan struct{})
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download":
+			_, _ = io.WriteString(w, "first\n")
+			w.(http.Flusher).Flush()
+			<-release
+			_, _ = io.WriteString(w, "second\n")
+		case "/upload":
+			br := bufio.NewReader(r.Body)
+			first, _ := br.ReadString('\n')
+			if first == "first\n" {
+				close(gotFirst)
+			}
+			rest, _ := io.ReadAll(br)
+			_, _ = fmt.Fprintf(w, "%s%s", first, rest)
+		}
+	}))
+	defer upstream.Close()
+	upstreamURL, err := url.Parse(upstream.URL)
+	require.NoError(t, err)
+
+	p, err := New([]*url.URL{upstreamURL})
+	require.NoError(t, err)
+	addr := startProxy(t, p)
+
+	t.Run("success: response body is streamed", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/download", nil)
+		require.NoError(t, err)
+		resp, err := client.New(client.WithTimeout(5 * time.Second)).Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, []string{"chunked"}, resp.TransferEncoding)
+
+		br := bufio.NewReader(resp.Body)
+		line, err := br.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "first\n", line)
+
+		close(release)
+		rest, err := io.ReadAll(br)
+		require.NoError(t, err)
+		assert.Equal(t, "second\n", string(rest))
+	})
+
+	t.Run("success: request body is streamed", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/upload", pr)
+		require.NoError(t, err)
+
+		type result struct {
+			body string
+			err  error
+		}
+		done := make(chan result, 1)
+		go func() {
+			resp, err := client.New().Do(req)
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			done <- result{body: string(body), err: err}
+		}()
+
+		_, err = io.WriteString(pw, "first\n")
+		require.NoError(t, err)
+		// upstream получает начало тела, пока клиент еще не дописал остальное
+		select {
+		case <-gotFirst:
+		case <-time.After(5 * time.Second):
+			t.Fatal("upstream did not receive the first part of the body")
+		}
+		_, err = io.WriteString(pw, "second\n")
+		require.NoError(t, err)
+		require.NoError(t, pw.Close())
+
+		res := <-done
+		require.NoError(t, res.err)
+		assert.Equal(t, "first\nsecond\n", res.body)
+	})
+}
+
+func TestReverseProxy_Balancing(t *testing.T) {
+	newUpstream := func(name string, hits *atomic.Int32) *url.URL {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hits.Add(1)
+			_, _ = io.WriteString(w, name)
+		}))
+		t.Cleanup(srv.Close)
+		u, err := url.Parse(srv.URL)
+		require.NoError(t, err)
+		return u
+	}
+	// адрес, на котором никто не слушает
+	deadURL := func() *url.URL {
+		port, err := freeport.GetFreePort()
+		require.NoError(t, err)
+		return &url.URL{Scheme: "http", Host: fmt.Sprintf("localhost:%d", port)}
+	}
+
+	do := func(t *testing.T, addr, method string) (int, string) {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader("payload")
+		}
+		req, err := http.NewRequest(method, "http://"+addr+"/", body)
+		require.NoError(t, err)
+		resp, err := client.New().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+
+	t.Run("success: round-robin across upstreams", func(t *testing.T) {
+		var hitsA, hitsB atomic.Int32
+		p, err := New([]*url.URL{newUpstream("a", &hitsA), newUpstream("b", &hitsB)})
+		require.NoError(t, err)
+		addr := startProxy(t, p)
+
+		var got []string
+		for i := 0; i < 4; i++ {
+			_, body := do(t, addr, http.MethodGet)
+			got = append(got, body)
+		}
+		assert.Equal(t, []string{"a", "b", "a", "b"}, got)
+	})
+
+	t.Run("success: failed upstream is skipped until fail timeout", func(t *testing.T) {
+		var hits atomic.Int32
+		p, err := New([]*url.URL{deadURL(), newUpstream("alive", &hits)}, WithFailTimeout(200*time.Millisecond))
+		require.NoError(t, err)
+		addr := startProxy(t, p)
+
+		// первый запрос падает на мертвом upstream'е и повторяется на живом
+		for i := 0; i < 4; i++ {
+			code, body := do(t, addr, http.MethodGet)
+			assert.Equal(t, http.StatusOK, code)
+			assert.Equal(t, "alive", body)
+		}
+		assert.Equal(t, int32(4), hits.Load())
+
+		// запрос с телом повторить нельзя, поэтому после fail timeout он получает 502
+		time.Sleep(300 * time.Millisecond)
+		code, _ := do(t, addr, http.MethodPost)
+		assert.Equal(t, http.StatusBadGateway, code)
+		code, body := do(t, addr, http.MethodPost)
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "alive", body)
+	})
+
+	t.Run("success: request dropped after processing is retried only if idempotent", func(t *testing.T) {
+		// upstream выполняет запрос и рвет соединение, не ответив
+		var dropped atomic.Int32
+		dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			dropped.Add(1)
+			conn, _, err := http.NewResponseController(w).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+		}))
+		t.Cleanup(dropping.Close)
+		droppingURL, err := url.Parse(dropping.URL)
+		require.NoError(t, err)
+
+		tests := []struct {
+			name        string
+			method      string
+			header      http.Header
+			wantStatus  int
+			wantDropped int32
+			wantHits    int32
+		}{
+			{
+				name:        "success: get goes to next upstream",
+				method:      http.MethodGet,
+				wantStatus:  http.StatusOK,
+				wantDropped: 1,
+				wantHits:    1,
+			},
+			{
+				name:        "error: bodyless post is not repeated",
+				method:      http.MethodPost,
+				wantStatus:  http.StatusBadGateway,
+				wantDropped: 1,
+			},
+			{
+				name:        "success: post with idempotency key goes to next upstream",
+				method:      http.MethodPost,
+				header:      http.Header{"Idempotency-Key": {"k1"}},
+				wantStatus:  http.StatusOK,
+				wantDropped: 1,
+				wantHits:    1,
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				dropped.Store(0)
+				var hits atomic.Int32
+				p, err := New([]*url.URL{droppingURL, newUpstream("alive", &hits)})
+				require.NoError(t, err)
+				addr := startProxy(t, p)
+
+				req, err := http.NewRequest(tt.method, "http://"+addr+"/", nil)
+				require.NoError(t, err)
+				for key, values := range tt.header {
+					req.Header[key] = values
+				}
+				resp, err := client.New().Do(req)
+				require.NoError(t, err)
+				_ = resp.Body.Close()
+
+				assert.Equal(t, tt.wantStatus, resp.StatusCode)
+				assert.Equal(t, tt.wantDropped, dropped.Load())
+				assert.Equal(t, tt.wantHits, hits.Load())
+			})
+		}
+	})
+
+	t.Run("success: bodyless post retried when upstream is unreachable", func(t *testing.T) {
+		var hits atomic.Int32
+		p, err := New([]*url.URL{deadURL(), newUpstream("alive", &hits)})
+		require.NoError(t, err)
+		addr := startProxy(t, p)
+
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", nil)
+		require.NoError(t, err)
+		resp, err := client.New().Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, int32(1), hits.Load())
+	})
+
+	t.Run("error: all upstreams are down", func(t *testing.T) {
+		p, err := New([]*url.URL{deadURL(), deadURL()})
+		require.NoError(t, err)
+		addr := startProxy(t, p)
+
+		code, _ := do(t, addr, http.MethodGet)
+		assert.Equal(t, http.StatusBadGateway, code)
+	})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(nil)
+	assert.Error(t, err)
+	_, err = New([]*url.URL{{Scheme: "ftp", Host: "example.com"}})
+	assert.Error(t, err)
+	_, err = New([]*url.URL{{Path: "/relative"}})
+	assert.Error(t, err)
+}
+
+// startProxy поднимает прокси на myhttp сервере
+func startProxy(t *testing.T, p *ReverseProxy) string {
+	t.Helper()
+
+	port, err := freeport.GetFreePort()
+	require.NoError(t, err)
+	addr := fmt.Sprintf("localhost:%d", port)
+	srv := server.New()
+	go func() {
+		_ = srv.ListenAndServe(addr, p)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+	// ждём пока прокси поднимется
+	time.Sleep(100 * time.Millisecond)
+	return addr
+}
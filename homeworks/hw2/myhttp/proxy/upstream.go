@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// upstream - один сервер, на который прокси пересылает запросы
+type upstream struct {
+	url *url.URL
+
+	mu        sync.Mutex
+	fails     int       // ошибок подряд
+	downUntil time.Time // до какого момента upstream исключен из ротации
+}
+
+func (u *upstream) available(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return !now.Before(u.downUntil)
+}
+
+// markFailed учитывает ошибку соединения с upstream'ом. После maxFails ошибок подряд
+// upstream исключается из ротации на failTimeout; maxFails <= 0 отключает учет ошибок.
+func (u *upstream) markFailed(maxFails int, failTimeout time.Duration) {
+	if maxFails <= 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails++
+	if u.fails >= maxFails {
+		u.fails = 0
+		u.downUntil = time.Now().Add(failTimeout)
+	}
+}
+
+func (u *upstream) markOK() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.fails = 0
+}
+
+// balancer раздает запросы upstream'ам по кругу, пропуская недоступные
+type balancer struct {
+	upstreams []*upstream
+	counter   atomic.Uint64
+}
+
+// pick выбирает следующий доступный upstream. Если недоступны все, берет следующий по кругу:
+// лучше попробовать, чем сразу отказать.
+func (b *balancer) pick() *upstream {
+	n := uint64(len(b.upstreams))
+	start := b.counter.Add(1) - 1
+	now := time.Now()
+	for i := uint64(0); i < n; i++ {
+		if u := b.upstreams[(start+i)%n]; u.available(now) {
+			// следующий запрос начнет со следующего за выбранным
+			b.counter.Store(start + i + 1)
+			return u
+		}
+	}
+	return b.upstreams[start%n]
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// AllowMethods пропускает только запросы с перечисленными методами, остальным отвечает 405
+// с заголовком Allow
+func AllowMethods(methods ...string) Middleware {
+	allow := strings.Join(methods, ", ")
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !slices.Contains(methods, r.Method) {
+				w.Header().Set("Allow", allow)
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireAuthorization отвечает 401 на запросы без заголовка Authorization.
+// Содержимое заголовка не проверяется - это дело обработчика или следующей middleware.
+func RequireAuthorization(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+)
+
+// Middleware оборачивает обработчик: проверяет запрос, дополняет ответ и т.д.
+type Middleware func(http.Handler) http.Handler
+
+// Router - маршрутизатор одного сервера. Шаблоны те же, что у http.ServeMux с Go 1.22:
+// метод и {параметры} пути ("GET /users/{id}", "/files/{path...}"), значения параметров
+// доступны через r.PathValue. В отличие от http.HandleFunc, в http.DefaultServeMux ничего
+// не регистрируется, поэтому у каждого сервера (и каждого теста) свои маршруты.
+type Router struct {
+	mux         *http.ServeMux
+	middlewares []Middleware
+	handler     http.Handler
+}
+
+// New создает пустой Router. middlewares применяются ко всем запросам, в том числе
+// к тем, на которые нет маршрута, первый из них - внешний.
+func New(middlewares ...Middleware) *Router {
+	r := &Router{mux: http.NewServeMux()}
+	r.Use(middlewares...)
+	return r
+}
+
+// Use добавляет middleware ко всем запросам. Как и маршруты, их нужно добавить до запуска сервера.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.handler = Chain(r.middlewares...)(r.mux)
+}
+
+// Handle регистрирует обработчик для шаблона. middlewares применяются только к этому маршруту,
+// после общих. Для неверного или конфликтующего шаблона Handle паникует, как http.ServeMux.
+func (r *Router) Handle(pattern string, handler http.Handler, middlewares ...Middleware) {
+	r.mux.Handle(pattern, Chain(middlewares...)(handler))
+}
+
+// HandleFunc - то же, что Handle, для функции-обработчика
+func (r *Router) HandleFunc(pattern string, handler http.HandlerFunc, middlewares ...Middleware) {
+	r.Handle(pattern, handler, middlewares...)
+}
+
+// ServeHTTP передает запрос подходящему обработчику. Если маршрута нет, отвечает 404, а если
+// путь есть, но для другого метода - 405 с заголовком Allow.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.handler.ServeHTTP(w, req)
+}
+
+// Chain собирает middlewares в одну: запрос проходит их по порядку, первая - внешняя
+func Chain(middlewares ...Middleware) Middleware {
+	return func(next http.Handler) http.Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			next = middlewares[i](next)
+		}
+		return next
+	}
+}
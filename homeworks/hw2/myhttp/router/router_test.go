@@ -0,0 +1,171 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
+)
+
+func TestRouter(t *testing.T) {
+	var trace []string
+	tag := func(name string) Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				trace = append(trace, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	r := New(tag("global-1"), tag("global-2"))
+	r.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "user %s", req.PathValue("id"))
+	})
+	r.HandleFunc("POST /users", func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}, RequireAuthorization, tag("route"))
+	r.HandleFunc("/files/{path...}", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = io.WriteString(w, req.PathValue("path"))
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		header     http.Header
+		wantStatus int
+		wantBody   string
+		wantAllow  string
+		wantTrace  []string
+	}{
+		{
+			name:       "success: path parameter",
+			method:     http.MethodGet,
+			target:     "/users/42",
+			wantStatus: http.StatusOK,
+			wantBody:   "user 42",
+			wantTrace:  []string{"global-1", "global-2"},
+		},
+		{
+			name:       "success: wildcard rest of path",
+			method:     http.MethodGet,
+			target:     "/files/docs/readme.md",
+			wantStatus: http.StatusOK,
+			wantBody:   "docs/readme.md",
+			wantTrace:  []string{"global-1", "global-2"},
+		},
+		{
+			name:       "success: route middleware after global",
+			method:     http.MethodPost,
+			target:     "/users",
+			header:     http.Header{"Authorization": {"Bearer token"}},
+			wantStatus: http.StatusCreated,
+			wantTrace:  []string{"global-1", "global-2", "route"},
+		},
+		{
+			name:       "error: route middleware rejects",
+			method:     http.MethodPost,
+			target:     "/users",
+			wantStatus: http.StatusUnauthorized,
+			wantBody:   "Unauthorized\n",
+			wantTrace:  []string{"global-1", "global-2"},
+		},
+		{
+			name:       "error: wrong method",
+			method:     http.MethodDelete,
+			target:     "/users/42",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantBody:   "Method Not Allowed\n",
+			wantAllow:  "GET, HEAD",
+			wantTrace:  []string{"global-1", "global-2"},
+		},
+		{
+			name:       "error: not found passes global middleware",
+			method:     http.MethodGet,
+			target:     "/unknown",
+			wantStatus: http.StatusNotFound,
+			wantBody:   "404 page not found\n",
+			wantTrace:  []string{"global-1", "global-2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trace = nil
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			assert.Equal(t, tt.wantAllow, rr.Header().Get("Allow"))
+			assert.Equal(t, tt.wantTrace, trace)
+		})
+	}
+}
+
+func TestAllowMethods(t *testing.T) {
+	h := AllowMethods(http.MethodGet, http.MethodPost)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+
+	tests := []struct {
+		method     string
+		wantStatus int
+		wantAllow  string
+	}{
+		{method: http.MethodGet, wantStatus: http.StatusOK},
+		{method: http.MethodPost, wantStatus: http.StatusOK},
+		{method: http.MethodPut, wantStatus: http.StatusMethodNotAllowed, wantAllow: "GET, POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, httptest.NewRequest(tt.method, "/", nil))
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, tt.wantAllow, rr.Header().Get("Allow"))
+		})
+	}
+}
+
+func TestRouter_MyHTTPServer(t *testing.T) {
+	r := New()
+	r.HandleFunc("GET /greet/{name}", func(w http.ResponseWriter, req *http.Request) {
+		_, _ = fmt.Fprintf(w, "Hello, %s!", req.PathValue("name"))
+	})
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	srv := server.New()
+	go func() {
+		if err := srv.Serve(l, r); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("server error", err)
+		}
+	}()
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/greet/gopher", nil)
+	require.NoError(t, err)
+	resp, err := client.New().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "Hello, gopher!", string(body))
+}
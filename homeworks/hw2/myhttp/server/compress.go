@@ -0,0 +1,88 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
+)
+
+// defaultCompressionMinSize - ответы короче этого сжимать невыгодно
+const defaultCompressionMinSize = 1024
+
+// negotiateEncoding выбирает Content-Encoding для ответа по Accept-Encoding запроса.
+// gzip предпочтительнее deflate; пустая строка - клиент сжатие не принимает.
+func negotiateEncoding(header http.Header) string {
+	weights := make(map[string]float64)
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, part := range strings.Split(value, ",") {
+			name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+			q := 1.0
+			if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				parsed, err := strconv.ParseFloat(v, 64)
+				if err != nil {
+					continue
+				}
+				q = parsed
+			}
+			weights[strings.ToLower(strings.TrimSpace(name))] = q
+		}
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{"gzip", "deflate"} {
+		q, ok := weights[encoding]
+		if !ok {
+			q, ok = weights["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressible сообщает, стоит ли сжимать ответ с таким кодом и заголовками
+func compressible(status int, header http.Header) bool {
+	if !convert.BodyAllowedForStatus(status) || status == http.StatusPartialContent {
+		return false
+	}
+	if header.Get("Content-Encoding") != "" || header.Get("Content-Range") != "" {
+		return false
+	}
+	return compressibleType(header.Get("Content-Type"))
+}
+
+// compressibleType - текстовые форматы; картинки, архивы и видео уже сжаты
+func compressibleType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") || strings.HasSuffix(mediaType, "+xml") {
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// weakenETag делает ETag сжатого ответа слабым: сильный валидатор принадлежит несжатому
+// представлению, и с ним If-Range или кеш смешали бы байты разных представлений (RFC 9110, 8.8.3)
+func weakenETag(header http.Header) {
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+}
+
+// addVary добавляет token в Vary, если его там еще нет
+func addVary(header http.Header, token string) {
+	if !convert.HeaderHasToken(header, "Vary", token) {
+		header.Add("Vary", token)
+	}
+}
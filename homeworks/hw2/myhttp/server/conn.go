@@ -0,0 +1,571 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
+)
+
+const (
+	// maxPostHandlerReadBytes - сколько непрочитанного обработчиком тела запроса сервер готов
+	// дочитать сам, чтобы не рвать keep-alive соединение
+	maxPostHandlerReadBytes = 256 << 10
+	// rstAvoidanceDelay - сколько после ответа с ошибкой дочитываем входящие данные, чтобы
+	// закрытие соединения с непрочитанными байтами не превратилось в RST раньше ответа
+	rstAvoidanceDelay = 500 * time.Millisecond
+)
+
+var (
+	// errPipelineAborted - соединение закрывается из-за одного из предыдущих запросов конвейера,
+	// и ответ на этот запрос уже не отправить
+	errPipelineAborted = errors.New("connection closed by an earlier pipelined request")
+)
+
+// aLongTimeAgo - дедлайн в прошлом, чтобы мгновенно прервать блокирующее чтение
+var aLongTimeAgo = time.Unix(1, 0)
+
+// conn - одно клиентское соединение, по которому последовательно обслуживаются запросы
+type conn struct {
+	srv *myServer
+	rwc net.Conn
+	br  *bufio.Reader
+	bw  *bufio.Writer
+
+	// state - http.ConnState в младших 8 битах и unix-время перехода в остальных
+	state atomic.Uint64
+	// cancelCtx отменяет контекст всех запросов соединения при его принудительном закрытии
+	cancelCtx context.CancelFunc
+	// tlsState - результат TLS-рукопожатия, nil для обычного TCP
+	tlsState *tls.ConnectionState
+	// hijacked - соединение забрал обработчик, закрывать его теперь не нам
+	hijacked bool
+	// aborted - запрос, обработанный одновременно с чтением следующих, решил закрыть соединение
+	aborted atomic.Bool
+}
+
+func newConn(srv *myServer, rwc net.Conn) *conn {
+	c := &conn{
+		srv: srv,
+		rwc: rwc,
+		br:  bufio.NewReader(rwc),
+		bw:  bufio.NewWriter(rwc),
+	}
+	c.setState(http.StateNew)
+	return c
+}
+
+func (c *conn) serve(ctx context.Context, handler http.Handler) {
+	defer c.close()
+
+	if tlsConn, ok := c.rwc.(*tls.Conn); ok {
+		if err := c.handshake(ctx, tlsConn); err != nil {
+			log.Printf("myhttp: TLS handshake error from %v: %v", c.rwc.RemoteAddr(), err)
+			return
+		}
+	}
+
+	// prev - очередь ответа на последний прочитанный запрос; ответ на следующий уйдет после него
+	prev := newResponseTurn()
+	prev.finish(true)
+	pipelined := 0
+	for first := true; ; first = false {
+		if c.br.Buffered() == 0 {
+			// следующий запрос еще не пришел: дожидаемся ответов на прочитанные и переходим в простой
+			if !prev.wait() {
+				return
+			}
+			pipelined = 0
+			if !first {
+				c.setState(http.StateIdle)
+			}
+		}
+		if !c.waitRequest(first) {
+			prev.wait()
+			return
+		}
+		c.setState(http.StateActive)
+		req, err := c.readRequest()
+		if c.aborted.Load() {
+			prev.wait()
+			return
+		}
+		if err != nil {
+			// об ошибке сообщаем после ответов на все прочитанные запросы
+			if prev.wait() {
+				c.writeError(statusForReadError(err))
+			}
+			return
+		}
+
+		cur := newResponseTurn()
+		// одновременно обрабатываем, только если следующий запрос уже пришел: одиночный запрос
+		// обслуживается как обычно и может, например, забрать соединение через Hijack
+		if n := c.srv.opts.maxPipelinedRequests; n > 1 && canPipeline(req) && c.br.Buffered() > 0 {
+			if pipelined >= n {
+				if !prev.wait() {
+					return
+				}
+				pipelined = 0
+			}
+			pipelined++
+			// следующий запрос читаем, не дожидаясь обработчика этого
+			go func(prev *responseTurn) {
+				if !c.serveInTurn(ctx, handler, req, prev, cur, true) {
+					c.abortRead()
+				}
+			}(prev)
+		} else if !c.serveInTurn(ctx, handler, req, prev, cur, false) {
+			return
+		}
+		prev = cur
+	}
+}
+
+// responseTurn - очередь на запись ответа. Запросы конвейера (RFC 9112, 9.3.2) могут
+// обрабатываться одновременно, но ответы уходят строго в порядке запросов.
+type responseTurn struct {
+	done chan struct{}
+	ok   bool // соединение годится для следующего ответа; читать только после done
+}
+
+func newResponseTurn() *responseTurn {
+	return &responseTurn{done: make(chan struct{})}
+}
+
+// finish передает очередь следующему ответу
+func (t *responseTurn) finish(ok bool) {
+	t.ok = ok
+	close(t.done)
+}
+
+// wait дожидается очереди и сообщает, можно ли писать в соединение
+func (t *responseTurn) wait() bool {
+	<-t.done
+	return t.ok
+}
+
+// serveInTurn обслуживает запрос, отправляя ответ только после ответа из prev, и затем
+// передает очередь через cur. concurrent - запрос обрабатывается одновременно с чтением следующих.
+func (c *conn) serveInTurn(ctx context.Context, handler http.Handler, req *http.Request, prev, cur *responseTurn, concurrent bool) bool {
+	ok := c.serveRequest(ctx, handler, req, prev, concurrent)
+	// даже если ответ не понадобился, очередь передается только после предыдущих
+	ok = prev.wait() && ok
+	cur.finish(ok)
+	return ok
+}
+
+// canPipeline сообщает, можно ли обработать запрос одновременно с предыдущими и читать следующий,
+// не дожидаясь ответа: у него нет тела, метод безопасен (RFC 9110, 9.2.1) и соединение после
+// него не закрывается и не меняет протокол
+func canPipeline(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+	default:
+		return false
+	}
+	return req.Body == http.NoBody && !req.Close &&
+		req.Header.Get("Expect") == "" && req.Header.Get("Upgrade") == ""
+}
+
+// abortRead прерывает чтение следующих запросов: соединение будет закрыто
+func (c *conn) abortRead() {
+	c.aborted.Store(true)
+	_ = c.rwc.SetReadDeadline(aLongTimeAgo)
+}
+
+// handshake проводит TLS-рукопожатие, укладываясь в ReadHeaderTimeout, и запоминает его результат
+func (c *conn) handshake(ctx context.Context, tlsConn *tls.Conn) error {
+	if d := c.srv.opts.headerTimeout(); d > 0 {
+		deadline := time.Now().Add(d)
+		_ = c.rwc.SetReadDeadline(deadline)
+		_ = c.rwc.SetWriteDeadline(deadline)
+	}
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	_ = c.rwc.SetWriteDeadline(time.Time{})
+	state := tlsConn.ConnectionState()
+	c.tlsState = &state
+	return nil
+}
+
+// waitRequest ждет первый байт следующего запроса не дольше IdleTimeout, а для первого
+// запроса на соединении - не дольше ReadHeaderTimeout.
+// false означает, что клиент закрыл соединение или молчал слишком долго.
+func (c *conn) waitRequest(first bool) bool {
+	d := c.srv.opts.keepAliveTimeout()
+	if ht := c.srv.opts.headerTimeout(); first && ht > 0 {
+		d = ht
+	}
+	var deadline time.Time
+	if d > 0 {
+		deadline = time.Now().Add(d)
+	}
+	_ = c.rwc.SetReadDeadline(deadline)
+	_, err := c.br.Peek(1)
+	return err == nil
+}
+
+// readRequest читает заголовки запроса с учетом таймаутов и MaxHeaderBytes
+// и выставляет дедлайны на чтение тела и запись ответа
+func (c *conn) readRequest() (*http.Request, error) {
+	opts := c.srv.opts
+	now := time.Now()
+
+	var headerDeadline, requestDeadline time.Time
+	if d := opts.headerTimeout(); d > 0 {
+		headerDeadline = now.Add(d)
+	}
+	if d := opts.readTimeout; d > 0 {
+		requestDeadline = now.Add(d)
+	}
+	_ = c.rwc.SetReadDeadline(headerDeadline)
+
+	parseOpts := []convert.ParseOption{convert.WithMaxHeaderBytes(opts.maxHeaderBytes)}
+	if opts.strictLineEndings {
+		parseOpts = append(parseOpts, convert.WithStrictLineEndings())
+	}
+	req, err := convert.ParseRequest(c.br, parseOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = c.rwc.SetReadDeadline(requestDeadline)
+	var writeDeadline time.Time
+	if d := opts.writeTimeout; d > 0 {
+		writeDeadline = time.Now().Add(d)
+	}
+	_ = c.rwc.SetWriteDeadline(writeDeadline)
+	return req, nil
+}
+
+// statusForReadError выбирает код ответа на запрос, который не удалось прочитать.
+// Нарушения синтаксиса из convert дают 400, кроме того, что мы просто не поддерживаем.
+func statusForReadError(err error) int {
+	switch {
+	case errors.Is(err, convert.ErrHeaderTooLarge):
+		return http.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		return http.StatusRequestTimeout
+	case errors.Is(err, convert.ErrTransferEncodingHTTP10),
+		errors.Is(err, convert.ErrMissingHost), errors.Is(err, convert.ErrDuplicateHost):
+		return http.StatusBadRequest
+	case errors.Is(err, convert.ErrUnsupportedTransferEncoding):
+		return http.StatusNotImplemented
+	case errors.Is(err, convert.ErrUnsupportedVersion):
+		return http.StatusHTTPVersionNotSupported
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// serveRequest обрабатывает один запрос и сообщает, можно ли читать следующий.
+// Писать в соединение можно только после того, как prev сообщит об отправке предыдущего ответа.
+func (c *conn) serveRequest(ctx context.Context, handler http.Handler, req *http.Request, prev *responseTurn, concurrent bool) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if req.Header.Get("Expect") != "" && !expectsContinue(req) {
+		// других ожиданий, кроме 100-continue, RFC 9110 не определяет
+		if prev.wait() {
+			c.writeError(http.StatusExpectationFailed)
+		}
+		return false
+	}
+
+	body := &requestBody{r: req.Body}
+	req.Body = body
+	req.RemoteAddr = c.rwc.RemoteAddr().String()
+	req.TLS = c.tlsState
+	req = req.WithContext(ctx)
+
+	closeAfter := req.Close || c.srv.isClosed()
+	w := newStreamingResponseWriter(c.bw, req, closeAfter)
+	w.stream.wait = prev.wait
+	if !concurrent {
+		// соединение нельзя забрать, пока не ушли ответы на предыдущие запросы
+		w.stream.hijack = func() (net.Conn, *bufio.ReadWriter, error) {
+			if !prev.wait() {
+				return nil, nil, errPipelineAborted
+			}
+			return c.hijack()
+		}
+	}
+	w.stream.reqBody = body
+
+	var info RequestInfo
+	if hook := c.srv.opts.requestStart; hook != nil {
+		hook(req)
+	}
+	if hook := c.srv.opts.requestFinish; hook != nil {
+		start := time.Now()
+		defer func() {
+			if w.isStreaming() {
+				// заголовки ушли, даже если обработчик потом запаниковал
+				info.StatusCode = w.status
+			}
+			info.BytesWritten = w.written
+			info.Duration = time.Since(start)
+			hook(req, info)
+		}()
+	}
+	if expectsContinue(req) && req.ContentLength != 0 {
+		body.sendContinue = func() error {
+			if w.wroteHeader || w.isStreaming() || w.isHijacked() {
+				// окончательный ответ уже выбран, 100 Continue перед ним не отправить
+				return nil
+			}
+			if !prev.wait() {
+				return errPipelineAborted
+			}
+			if _, err := io.WriteString(c.bw, "HTTP/1.1 100 Continue\r\n\r\n"); err != nil {
+				return err
+			}
+			return c.bw.Flush()
+		}
+	}
+	w.stream.compress = c.srv.opts.compressionMinSize > 0
+	w.stream.compressMinSize = c.srv.opts.compressionMinSize
+	if w.stream.compressMinSize <= 0 {
+		w.stream.compressMinSize = defaultCompressionMinSize
+	}
+	w.stream.encoding = negotiateEncoding(req.Header)
+	// временные файлы формы живут до конца ответа, как и в net/http
+	defer func() {
+		if req.MultipartForm != nil {
+			_ = req.MultipartForm.RemoveAll()
+		}
+	}()
+	if code, err := c.parseMultipartForm(req); err != nil {
+		http.Error(w, http.StatusText(code), code)
+	} else if !runHandler(handler, w, req) || c.hijacked {
+		return false
+	}
+
+	if w.isStreaming() {
+		// заголовки уже ушли клиенту, осталось завершить тело
+		if err := w.finishStream(); err != nil {
+			return false
+		}
+		return !w.stream.closeAfter && !convert.HeaderHasToken(w.snapshot, "Connection", "close") && !c.srv.isClosed() && body.drain()
+	}
+
+	resp, err := w.GetResponse()
+	if err != nil {
+		return false
+	}
+
+	// клиент, не дождавшийся 100 Continue, мог и не отправить тело: где кончается запрос, неизвестно
+	keepAlive := !closeAfter && !body.continuePending() &&
+		!convert.HeaderHasToken(resp.Header, "Connection", "close") && !c.srv.isClosed()
+	// следующий запрос начинается сразу за телом текущего, поэтому его нужно дочитать
+	if keepAlive && !body.drain() {
+		keepAlive = false
+	}
+	if body.malformed != nil {
+		// запрос оказался некорректным уже в теле: что бы ни ответил обработчик, клиенту нужна ошибка
+		if prev.wait() {
+			c.writeError(statusForReadError(body.malformed))
+		}
+		return false
+	}
+	switch {
+	case !keepAlive:
+		resp.Header.Set("Connection", "close")
+	case !req.ProtoAtLeast(1, 1):
+		// клиент HTTP/1.0 без этого заголовка закроет соединение сам
+		resp.Header.Set("Connection", "keep-alive")
+	}
+	if req.Method == http.MethodHead {
+		resp.Body = nil
+	}
+
+	if !prev.wait() {
+		return false
+	}
+	if err := c.writeResponse(resp); err != nil {
+		return false
+	}
+	info.StatusCode = resp.StatusCode
+	return keepAlive
+}
+
+// parseMultipartForm заранее разбирает multipart/form-data, если это включено WithMaxMultipartMemory,
+// и при ошибке возвращает код ответа
+func (c *conn) parseMultipartForm(req *http.Request) (int, error) {
+	n := c.srv.opts.maxMultipartMemory
+	if n <= 0 || req.ContentLength == 0 {
+		return 0, nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType != "multipart/form-data" {
+		return 0, nil
+	}
+	if err := req.ParseMultipartForm(n); err != nil {
+		if errors.Is(err, multipart.ErrMessageTooLarge) {
+			return http.StatusRequestEntityTooLarge, err
+		}
+		return http.StatusBadRequest, err
+	}
+	return 0, nil
+}
+
+// runHandler вызывает обработчик и перехватывает его панику, как это делает net/http
+func runHandler(handler http.Handler, w http.ResponseWriter, req *http.Request) (ok bool) {
+	defer func() {
+		if err := recover(); err != nil {
+			ok = false
+			if err != http.ErrAbortHandler {
+				log.Printf("myhttp: panic serving %v: %v\n%s", req.RemoteAddr, err, debug.Stack())
+			}
+		}
+	}()
+	handler.ServeHTTP(w, req)
+	return true
+}
+
+func (c *conn) writeResponse(resp *http.Response) error {
+	// convert.WriteResponse ждет в Status только reason-phrase
+	resp.Status = http.StatusText(resp.StatusCode)
+	if err := convert.WriteResponse(c.bw, resp); err != nil {
+		return err
+	}
+	return c.bw.Flush()
+}
+
+// writeError отвечает ошибкой на запрос, который не дошел до обработчика, и закрывает соединение
+func (c *conn) writeError(code int) {
+	w := NewResponseWriter()
+	w.Header().Set("Connection", "close")
+	http.Error(w, http.StatusText(code), code)
+	resp, err := w.GetResponse()
+	if err != nil {
+		return
+	}
+	if err := c.writeResponse(resp); err != nil {
+		return
+	}
+	c.closeWriteAndWait()
+}
+
+// closeWriteAndWait закрывает соединение на запись и недолго дочитывает то, что еще шлет клиент
+func (c *conn) closeWriteAndWait() {
+	if cw, ok := c.rwc.(interface{ CloseWrite() error }); ok {
+		_ = cw.CloseWrite()
+	}
+	_ = c.rwc.SetReadDeadline(time.Now().Add(rstAvoidanceDelay))
+	_, _ = io.CopyN(io.Discard, c.rwc, maxPostHandlerReadBytes)
+}
+
+// hijack отдает соединение обработчику: снимает дедлайны и перестает учитывать его в сервере
+func (c *conn) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if err := c.rwc.SetDeadline(time.Time{}); err != nil {
+		return nil, nil, err
+	}
+	c.hijacked = true
+	c.setState(http.StateHijacked)
+	c.srv.untrackConn(c)
+	return c.rwc, bufio.NewReadWriter(c.br, c.bw), nil
+}
+
+func (c *conn) close() {
+	c.cancelCtx()
+	if c.hijacked {
+		return
+	}
+	_ = c.rwc.Close()
+	c.setState(http.StateClosed)
+	c.srv.untrackConn(c)
+}
+
+// setState запоминает состояние соединения и сообщает о его смене хуку из WithConnState
+func (c *conn) setState(state http.ConnState) {
+	old := c.state.Swap(uint64(time.Now().Unix())<<8 | uint64(state))
+	// запросы конвейера идут подряд без простоя, о каждом StateActive сообщать незачем
+	if hook := c.srv.opts.connState; hook != nil && (http.ConnState(old&0xff) != state || old == 0) {
+		hook(c.rwc, state)
+	}
+}
+
+func (c *conn) getState() (http.ConnState, time.Time) {
+	packed := c.state.Load()
+	return http.ConnState(packed & 0xff), time.Unix(int64(packed>>8), 0)
+}
+
+// requestBody - тело запроса, которое видит обработчик. Close не трогает соединение,
+// а оставшиеся байты потом дочитывает сервер.
+type requestBody struct {
+	r      io.Reader
+	closed bool
+	// sendContinue отправляет клиенту 100 Continue при первом чтении тела, nil - уже не нужно
+	sendContinue func() error
+	// continueDisabled - 100 Continue так и не отправлен, потому что обработчик ответил раньше
+	continueDisabled bool
+	// malformed - *convert.ParseError, на котором оборвалось чтение тела, например слишком большой трейлер
+	malformed error
+}
+
+func (b *requestBody) Read(p []byte) (int, error) {
+	if b.closed {
+		return 0, http.ErrBodyReadAfterClose
+	}
+	if send := b.sendContinue; send != nil {
+		b.sendContinue = nil
+		if err := send(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := b.r.Read(p)
+	b.checkMalformed(err)
+	return n, err
+}
+
+// checkMalformed запоминает ошибку разбора тела: на такой запрос сервер отвечает сам
+func (b *requestBody) checkMalformed(err error) {
+	var pe *convert.ParseError
+	if b.malformed == nil && errors.As(err, &pe) {
+		b.malformed = err
+	}
+}
+
+// continuePending сообщает, что клиент так и не получил 100 Continue и мог не отправить тело
+func (b *requestBody) continuePending() bool {
+	return b.sendContinue != nil || b.continueDisabled
+}
+
+// disableContinue отменяет 100 Continue: обработчик выбрал ответ, не дочитав тело
+func (b *requestBody) disableContinue() {
+	if b.sendContinue != nil {
+		b.sendContinue = nil
+		b.continueDisabled = true
+	}
+}
+
+func (b *requestBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+// drain дочитывает тело до конца и сообщает, удалось ли это в пределах лимита
+func (b *requestBody) drain() bool {
+	_, err := io.CopyN(io.Discard, b.r, maxPostHandlerReadBytes+1)
+	b.checkMalformed(err)
+	return err == io.EOF
+}
+
+// expectsContinue сообщает, что клиент ждет 100 Continue, прежде чем отправить тело
+func expectsContinue(req *http.Request) bool {
+	return req.ProtoAtLeast(1, 1) && convert.HeaderHasToken(req.Header, "Expect", "100-continue")
+}
@@ -1,8 +1,35 @@
 package server
 
-import "net/http"
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
 
 type HTTPServer interface {
 	ListenAndServe(addr string, handler http.Handler) error
+	// Serve обслуживает соединения, принятые из l: например, Unix-сокет, унаследованный
+	// от systemd дескриптор или listener в памяти для тестов. l закрывается вместе с сервером.
+	Serve(l net.Listener, handler http.Handler) error
+	// ListenAndServeTLS работает как ListenAndServe, но принимает только TLS-соединения.
+	// certFile и keyFile - сертификат сервера и его ключ в PEM; их можно не передавать,
+	// если сертификаты уже заданы через WithTLSConfig.
+	ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler) error
 	Close() error
+	// Shutdown перестает принимать соединения, дожидается завершения активных запросов
+	// и закрывает простаивающие соединения. Если ctx истекает раньше, оставшиеся соединения
+	// закрываются принудительно, а возвращается ошибка контекста.
+	Shutdown(ctx context.Context) error
+}
+
+// RequestInfo - итог обработки запроса, который сервер передает хуку из WithRequestHooks
+type RequestInfo struct {
+	// StatusCode - код отправленного ответа; 0, если ответ так и не ушел: обработчик
+	// запаниковал, забрал соединение через Hijack или соединение оборвалось
+	StatusCode int
+	// BytesWritten - сколько байт тела записал обработчик, до сжатия
+	BytesWritten int64
+	// Duration - время от прочтения заголовков запроса до отправки ответа
+	Duration time.Duration
 }
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultIdleTimeout - сколько keep-alive соединение может простаивать между запросами
+	defaultIdleTimeout = 2 * time.Minute
+	// defaultMaxHeaderBytes - ограничение на размер строки запроса и заголовков, как в net/http
+	defaultMaxHeaderBytes = 1 << 20
+	// defaultMaxPipelinedRequests - сколько запросов конвейера одного соединения обрабатываются одновременно
+	defaultMaxPipelinedRequests = 16
+)
+
+// Option настраивает сервер, создаваемый через New
+type Option func(*options)
+
+type options struct {
+	readHeaderTimeout time.Duration
+	readTimeout       time.Duration
+	writeTimeout      time.Duration
+	idleTimeout       time.Duration
+	maxHeaderBytes    int
+	tlsConfig         *tls.Config
+	// compressionMinSize > 0 включает сжатие ответов
+	compressionMinSize int
+	strictLineEndings  bool
+	// maxMultipartMemory > 0 - multipart/form-data разбирается до вызова обработчика
+	maxMultipartMemory int64
+	// maxPipelinedRequests > 1 - запросы конвейера обрабатываются одновременно
+	maxPipelinedRequests int
+	// хуки для наблюдения за сервером, nil - не вызываются
+	connState     func(net.Conn, http.ConnState)
+	requestStart  func(*http.Request)
+	requestFinish func(*http.Request, RequestInfo)
+}
+
+func defaultOptions() options {
+	return options{
+		idleTimeout:          defaultIdleTimeout,
+		maxHeaderBytes:       defaultMaxHeaderBytes,
+		maxPipelinedRequests: defaultMaxPipelinedRequests,
+	}
+}
+
+// WithReadHeaderTimeout ограничивает время на чтение строки запроса и заголовков.
+// Если не задан, используется ReadTimeout. Клиент, не уложившийся в него, получает 408.
+func WithReadHeaderTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readHeaderTimeout = d
+	}
+}
+
+// WithReadTimeout ограничивает время на чтение всего запроса вместе с телом
+func WithReadTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = d
+	}
+}
+
+// WithWriteTimeout ограничивает время от конца чтения заголовков до конца записи ответа
+func WithWriteTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.writeTimeout = d
+	}
+}
+
+// WithIdleTimeout задает, сколько keep-alive соединение может ждать следующий запрос.
+// 0 означает, что используется ReadTimeout.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.idleTimeout = d
+	}
+}
+
+// WithMaxHeaderBytes ограничивает размер строки запроса и заголовков, а также трейлера chunked-тела.
+// На запрос с заголовками или трейлером больше лимита сервер отвечает 431.
+func WithMaxHeaderBytes(n int) Option {
+	return func(o *options) {
+		o.maxHeaderBytes = n
+	}
+}
+
+// WithTLSConfig задает настройки TLS для ListenAndServeTLS: сертификаты, требования к
+// клиентским сертификатам (mTLS) и т.д. Сервер работает с копией конфигурации.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = cfg
+	}
+}
+
+// WithCompression включает сжатие ответов gzip или deflate для клиентов, приславших Accept-Encoding.
+// Сжимаются только текстовые форматы (text/*, JSON, XML, JavaScript) без своего Content-Encoding
+// и не короче minSize байт; 0 - значение по умолчанию, 1 КБ. Потоковые ответы (Flush) сжимаются
+// целиком, если обработчик не объявил Content-Length. Сильный ETag сжатого ответа становится слабым.
+// Для отдельного ответа сжатие включает или отключает SetCompression.
+func WithCompression(minSize int) Option {
+	return func(o *options) {
+		if minSize <= 0 {
+			minSize = defaultCompressionMinSize
+		}
+		o.compressionMinSize = minSize
+	}
+}
+
+// WithStrictLineEndings запрещает запросы, строки которых заканчиваются одиночным \n вместо \r\n.
+// Такой запрос получает 400: прокси перед сервером может разделить его на строки иначе.
+func WithStrictLineEndings() Option {
+	return func(o *options) {
+		o.strictLineEndings = true
+	}
+}
+
+// WithMaxMultipartMemory включает разбор multipart/form-data до вызова обработчика: r.MultipartForm,
+// r.FormValue и r.FormFile сразу готовы и не используют лимит net/http по умолчанию (32 МБ).
+// Файлы сверх maxMemory байт сохраняются во временные файлы, которые сервер удаляет после ответа.
+// На форму с ошибкой сервер отвечает 400, на слишком большие поля без файлов - 413.
+func WithMaxMultipartMemory(maxMemory int64) Option {
+	return func(o *options) {
+		o.maxMultipartMemory = maxMemory
+	}
+}
+
+// WithMaxPipelinedRequests задает, сколько запросов, присланных по одному соединению без ожидания
+// ответов (конвейер), могут обрабатываться одновременно. Одновременно обрабатываются только
+// безопасные запросы без тела, например GET; ответы в любом случае уходят в порядке запросов.
+// По умолчанию 16, 1 - запросы обрабатываются строго по одному, как в net/http.
+func WithMaxPipelinedRequests(n int) Option {
+	return func(o *options) {
+		o.maxPipelinedRequests = n
+	}
+}
+
+// WithConnState задает функцию, которую сервер вызывает при каждой смене состояния соединения,
+// как http.Server.ConnState: StateNew, StateActive, StateIdle, StateHijacked и StateClosed.
+// Вызов синхронный, поэтому fn должна быть быстрой, например обновлять счетчик соединений.
+func WithConnState(fn func(net.Conn, http.ConnState)) Option {
+	return func(o *options) {
+		o.connState = fn
+	}
+}
+
+// WithRequestHooks задает функции, которые сервер вызывает для каждого запроса, дошедшего до
+// обработчика: start - перед обработчиком, finish - после отправки ответа, с его кодом, размером
+// и длительностью. Запросы конвейера могут обрабатываться одновременно, поэтому хуки должны быть
+// потокобезопасными. Любая из функций может быть nil.
+func WithRequestHooks(start func(*http.Request), finish func(*http.Request, RequestInfo)) Option {
+	return func(o *options) {
+		o.requestStart = start
+		o.requestFinish = finish
+	}
+}
+
+// headerTimeout возвращает таймаут на чтение заголовков с учетом значения по умолчанию
+func (o options) headerTimeout() time.Duration {
+	if o.readHeaderTimeout > 0 {
+		return o.readHeaderTimeout
+	}
+	return o.readTimeout
+}
+
+// keepAliveTimeout возвращает таймаут простоя с учетом значения по умолчанию
+func (o options) keepAliveTimeout() time.Duration {
+	if o.idleTimeout > 0 {
+		return o.idleTimeout
+	}
+	return o.readTimeout
+}
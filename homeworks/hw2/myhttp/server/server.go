@@ -1,20 +1,239 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
+	"time"
 )
 
-func New() HTTPServer {
-	return &myServer{}
+const (
+	// shutdownPollInterval - как часто Shutdown проверяет, завершились ли активные запросы
+	shutdownPollInterval = 10 * time.Millisecond
+	// newConnGracePeriod - сколько Shutdown ждет первый запрос на только что принятом соединении
+	newConnGracePeriod = 5 * time.Second
+)
+
+// New создает сервер, настроенный опциями
+func New(opts ...Option) HTTPServer {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &myServer{opts: o}
 }
 
 type myServer struct {
+	opts options
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[*conn]struct{}
+	closed    bool
 }
 
 func (m *myServer) ListenAndServe(addr string, handler http.Handler) error {
-	panic("TODO: implement me")
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.serve(l, handler)
+}
+
+func (m *myServer) Serve(l net.Listener, handler http.Handler) error {
+	return m.serve(l, handler)
+}
+
+func (m *myServer) ListenAndServeTLS(addr, certFile, keyFile string, handler http.Handler) error {
+	cfg, err := m.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.serve(tls.NewListener(l, cfg), handler)
+}
+
+// tlsConfig собирает конфигурацию TLS из опций и файлов сертификата
+func (m *myServer) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	var cfg *tls.Config
+	if m.opts.tlsConfig != nil {
+		cfg = m.opts.tlsConfig.Clone()
+	} else {
+		cfg = &tls.Config{}
+	}
+	if len(cfg.NextProtos) == 0 {
+		// HTTP/2 мы не умеем, поэтому явно договариваемся об HTTP/1.1
+		cfg.NextProtos = []string{"http/1.1"}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = append(cfg.Certificates, cert)
+	}
+	if len(cfg.Certificates) == 0 && cfg.GetCertificate == nil && cfg.GetConfigForClient == nil {
+		return nil, errors.New("no TLS certificate: pass certFile and keyFile or set them in WithTLSConfig")
+	}
+	return cfg, nil
+}
+
+func (m *myServer) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.closed = true
+	err := m.closeListeners()
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for {
+		if m.closeIdleConns() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			_ = m.Close()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
 }
 
 func (m *myServer) Close() error {
-	panic("TODO: implement me")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	err := m.closeListeners()
+	for c := range m.conns {
+		c.cancelCtx()
+		_ = c.rwc.Close()
+	}
+	return err
+}
+
+// serve принимает соединения и обслуживает каждое в отдельной горутине
+func (m *myServer) serve(l net.Listener, handler http.Handler) error {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	if !m.trackListener(l) {
+		_ = l.Close()
+		return http.ErrServerClosed
+	}
+	defer m.untrackListener(l)
+
+	for {
+		rwc, err := l.Accept()
+		if err != nil {
+			if m.isClosed() {
+				return http.ErrServerClosed
+			}
+			return err
+		}
+
+		c := newConn(m, rwc)
+		ctx, cancel := context.WithCancel(context.Background())
+		c.cancelCtx = cancel
+		ctx = context.WithValue(ctx, http.LocalAddrContextKey, rwc.LocalAddr())
+		if !m.trackConn(c) {
+			cancel()
+			_ = rwc.Close()
+			c.setState(http.StateClosed)
+			return http.ErrServerClosed
+		}
+		go c.serve(ctx, handler)
+	}
+}
+
+func (m *myServer) trackListener(l net.Listener) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false
+	}
+	if m.listeners == nil {
+		m.listeners = make(map[net.Listener]struct{})
+	}
+	m.listeners[l] = struct{}{}
+	return true
+}
+
+func (m *myServer) untrackListener(l net.Listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.listeners, l)
+}
+
+// closeListeners закрывает все слушатели, на которых сейчас работает Serve.
+// Вызывается под m.mu.
+func (m *myServer) closeListeners() error {
+	var err error
+	for l := range m.listeners {
+		if cerr := l.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+		delete(m.listeners, l)
+	}
+	return err
+}
+
+func (m *myServer) trackConn(c *conn) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return false
+	}
+	if m.conns == nil {
+		m.conns = make(map[*conn]struct{})
+	}
+	m.conns[c] = struct{}{}
+	return true
+}
+
+func (m *myServer) untrackConn(c *conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.conns, c)
+}
+
+// closeIdleConns закрывает соединения без активных запросов и сообщает,
+// что активных соединений не осталось
+func (m *myServer) closeIdleConns() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	quiescent := true
+	for c := range m.conns {
+		state, since := c.getState()
+		// на новом соединении запрос мог быть уже в пути, даем ему немного времени
+		if state == http.StateNew && time.Since(since) > newConnGracePeriod {
+			state = http.StateIdle
+		}
+		if state != http.StateIdle {
+			quiescent = false
+			continue
+		}
+		_ = c.rwc.Close()
+		delete(m.conns, c)
+	}
+	return quiescent
+}
+
+func (m *myServer) isClosed() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.closed
 }
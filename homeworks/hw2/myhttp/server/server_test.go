@@ -1,16 +1,41 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math/big"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/phayes/freeport"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/convert"
 )
 
 const (
@@ -82,25 +107,8 @@ func Test_myServer_ListenAndServe(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			srv := New()
-
-			var err error
-			port := defaultPort
-			if port == 0 {
-				port, err = freeport.GetFreePort()
-				require.NoError(t, err)
-			}
-			addr := fmt.Sprintf("localhost:%v", port)
-
-			go func() {
-				err := srv.ListenAndServe(addr, tt.handler)
-				if err != nil {
-					log.Println("server error", err)
-				}
-			}()
-			defer srv.Close()
-
-			// ждём пока сервер поднимется
-			time.Sleep(time.Millisecond * 100)
+			addr, closeServer := startServer(t, srv, tt.handler)
+			defer closeServer()
 
 			resp, err := tt.doRequest(addr)
 			tt.wantErr(t, err)
@@ -129,3 +137,1825 @@ func (r *stringReader) Read(p []byte) (int, error) {
 	r.s = r.s[n:]
 	return n, nil
 }
+
+func Test_myServer_KeepAlive(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write([]byte(r.URL.Path + ":" + string(body)))
+	})
+
+	tests := []struct {
+		name       string
+		requests   string
+		wantBodies []string
+		wantClosed bool
+	}{
+		{
+			name: "success: two requests on one connection",
+			requests: "POST /first HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nping" +
+				"GET /second HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/first:ping", "/second:"},
+		},
+		{
+			name: "success: chunked body keeps connection framed",
+			requests: "POST /chunked HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+				"2\r\nab\r\n3\r\ncde\r\n0\r\n\r\n" +
+				"GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/chunked:abcde", "/after:"},
+		},
+		{
+			name: "success: unread body is drained before next request",
+			requests: "POST /unread HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n\r\nhello" +
+				"GET /next HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/unread:hello", "/next:"},
+		},
+		{
+			name: "success: client asks to close connection",
+			requests: "GET /bye HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n" +
+				"GET /ignored HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/bye:"},
+			wantClosed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = conn.Write([]byte(tt.requests))
+			require.NoError(t, err)
+
+			br := bufio.NewReader(conn)
+			for i, want := range tt.wantBodies {
+				resp, err := convert.ParseResponse(br)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, want, string(body))
+				assert.Equal(t, tt.wantClosed && i == len(tt.wantBodies)-1, resp.Close)
+			}
+
+			if tt.wantClosed {
+				_, err := br.ReadByte()
+				assert.ErrorIs(t, err, io.EOF)
+			}
+		})
+	}
+}
+
+func Test_myServer_Pipelining(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		requests   string
+		wantBodies []string
+		wantClosed bool
+		// wantConcurrent - обработчики работали одновременно, wantSequential - строго по одному
+		wantConcurrent bool
+		wantSequential bool
+	}{
+		{
+			name: "success: responses keep request order",
+			requests: "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"HEAD /head HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"GET /last HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies:     []string{"/slow:", "/fast:", "", "/last:"},
+			wantConcurrent: true,
+		},
+		{
+			name: "success: one at a time when disabled",
+			opts: []Option{WithMaxPipelinedRequests(1)},
+			requests: "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies:     []string{"/slow:", "/fast:"},
+			wantSequential: true,
+		},
+		{
+			name: "success: request with body waits its turn",
+			requests: "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"POST /echo HTTP/1.1\r\nHost: localhost\r\nContent-Length: 4\r\n\r\nping" +
+				"GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/slow:", "/echo:ping", "/fast:"},
+		},
+		{
+			name: "success: handler closing connection drops later responses",
+			requests: "GET /close HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"GET /fast HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/close:"},
+			wantClosed: true,
+		},
+		{
+			name: "success: malformed request answered after earlier ones",
+			requests: "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n" +
+				"GET / HTTP/9.9\r\nHost: localhost\r\n\r\n",
+			wantBodies: []string{"/slow:", "HTTP Version Not Supported\n"},
+			wantClosed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var active, maxActive atomic.Int32
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := active.Add(1)
+				defer active.Add(-1)
+				for m := maxActive.Load(); n > m && !maxActive.CompareAndSwap(m, n); m = maxActive.Load() {
+				}
+				switch r.URL.Path {
+				case "/slow":
+					// остальные запросы успевают обработаться раньше, но отвечать им рано
+					time.Sleep(200 * time.Millisecond)
+				case "/close":
+					w.Header().Set("Connection", "close")
+				}
+				body, _ := io.ReadAll(r.Body)
+				_, _ = w.Write([]byte(r.URL.Path + ":" + string(body)))
+			})
+			addr, closeServer := startServer(t, New(tt.opts...), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			// все запросы уходят одной записью, не дожидаясь ответов
+			_, err = conn.Write([]byte(tt.requests))
+			require.NoError(t, err)
+
+			br := bufio.NewReader(conn)
+			for _, want := range tt.wantBodies {
+				resp, err := convert.ParseResponse(br)
+				require.NoError(t, err)
+				if want == "" {
+					// ответ на HEAD
+					resp.Body = http.NoBody
+				}
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, want, string(body))
+			}
+			if tt.wantClosed {
+				_, err := br.ReadByte()
+				assert.ErrorIs(t, err, io.EOF)
+			}
+			if tt.wantConcurrent {
+				assert.Greater(t, maxActive.Load(), int32(1))
+			}
+			if tt.wantSequential {
+				assert.Equal(t, int32(1), maxActive.Load())
+			}
+		})
+	}
+}
+
+func Test_myServer_HTTP10(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			_, _ = io.WriteString(w, "part1 ")
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "part2")
+		case "/trailer":
+			w.Header().Set("Trailer", "X-Checksum")
+			_, _ = io.WriteString(w, "body")
+			w.Header().Set("X-Checksum", "abc")
+		default:
+			_, _ = io.WriteString(w, r.Proto)
+		}
+	})
+
+	tests := []struct {
+		name           string
+		request        string
+		wantBody       string
+		wantConnection string
+		wantLength     int64
+		wantClosed     bool
+	}{
+		{
+			name:           "success: closes by default",
+			request:        "GET / HTTP/1.0\r\n\r\n",
+			wantBody:       "HTTP/1.0",
+			wantConnection: "close",
+			wantLength:     8,
+			wantClosed:     true,
+		},
+		{
+			name:           "success: explicit keep-alive",
+			request:        "GET / HTTP/1.0\r\nConnection: keep-alive\r\n\r\n",
+			wantBody:       "HTTP/1.0",
+			wantConnection: "keep-alive",
+			wantLength:     8,
+		},
+		{
+			name:           "success: streamed body ends with connection close",
+			request:        "GET /stream HTTP/1.0\r\nConnection: keep-alive\r\n\r\n",
+			wantBody:       "part1 part2",
+			wantConnection: "close",
+			wantLength:     -1,
+			wantClosed:     true,
+		},
+		{
+			name:           "success: trailer is dropped",
+			request:        "GET /trailer HTTP/1.0\r\nConnection: keep-alive\r\n\r\n",
+			wantBody:       "body",
+			wantConnection: "keep-alive",
+			wantLength:     4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = conn.Write([]byte(tt.request))
+			require.NoError(t, err)
+			br := bufio.NewReader(conn)
+			resp, err := convert.ParseResponse(br)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, "HTTP/1.0", resp.Proto)
+			assert.Empty(t, resp.TransferEncoding)
+			assert.Empty(t, resp.Trailer)
+			assert.Equal(t, tt.wantLength, resp.ContentLength)
+			assert.Equal(t, tt.wantBody, string(body))
+			assert.Equal(t, tt.wantConnection, resp.Header.Get("Connection"))
+
+			if tt.wantClosed {
+				_, err := br.ReadByte()
+				assert.ErrorIs(t, err, io.EOF)
+				return
+			}
+			// соединение осталось открытым для следующего запроса
+			_, err = conn.Write([]byte("GET /next HTTP/1.0\r\n\r\n"))
+			require.NoError(t, err)
+			resp, err = convert.ParseResponse(br)
+			require.NoError(t, err)
+			body, err = io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "HTTP/1.0", string(body))
+		})
+	}
+}
+func Test_myServer_IdleTimeout(t *testing.T) {
+	srv := New(WithIdleTimeout(100 * time.Millisecond))
+
+	addr, closeServer := startServer(t, srv, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer closeServer()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	br := bufio.NewReader(conn)
+	resp, err := convert.ParseResponse(br)
+	require.NoError(t, err)
+	assert.False(t, resp.Close)
+
+	// после ответа молчим дольше idleTimeout - сервер должен закрыть соединение
+	_, err = br.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+// startServer запускает srv на свободном порту и возвращает его адрес. Порт занимается заранее,
+// поэтому соединения принимаются сразу, без ожидания запуска сервера.
+func startServer(t *testing.T, srv HTTPServer, handler http.Handler) (string, func() error) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", fmt.Sprintf("localhost:%v", defaultPort))
+	require.NoError(t, err)
+
+	go func() {
+		err := srv.Serve(l, handler)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("server error", err)
+		}
+	}()
+	return l.Addr().String(), srv.Close
+}
+
+func Test_myServer_Serve(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen func(t *testing.T) (net.Listener, func(ctx context.Context, network, addr string) (net.Conn, error))
+	}{
+		{
+			name: "success: unix socket",
+			listen: func(t *testing.T) (net.Listener, func(ctx context.Context, network, addr string) (net.Conn, error)) {
+				path := filepath.Join(t.TempDir(), "myhttp.sock")
+				l, err := net.Listen("unix", path)
+				require.NoError(t, err)
+				dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", path)
+				}
+				return l, dial
+			},
+		},
+		{
+			name: "success: in-memory pipe",
+			listen: func(t *testing.T) (net.Listener, func(ctx context.Context, network, addr string) (net.Conn, error)) {
+				l := newPipeListener()
+				return l, l.DialContext
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, dial := tt.listen(t)
+			srv := New()
+			served := make(chan error, 1)
+			go func() {
+				served <- srv.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					_, _ = fmt.Fprintf(w, "hello %s", r.Host)
+				}))
+			}()
+
+			c := client.New(client.WithDialContext(dial))
+			// адрес в URL не важен: соединение открывает dial
+			for range 2 {
+				req, err := http.NewRequest(http.MethodGet, "http://myhttp.test/", nil)
+				require.NoError(t, err)
+				resp, err := c.Do(req)
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.NoError(t, resp.Body.Close())
+				assert.Equal(t, "hello myhttp.test", string(body))
+			}
+
+			require.NoError(t, srv.Close())
+			assert.ErrorIs(t, <-served, http.ErrServerClosed)
+		})
+	}
+}
+
+func Test_myServer_ServeMultipleListeners(t *testing.T) {
+	tests := []struct {
+		name string
+		stop func(srv HTTPServer) error
+	}{
+		{
+			name: "success: Close stops every listener",
+			stop: func(srv HTTPServer) error {
+				return srv.Close()
+			},
+		},
+		{
+			name: "success: Shutdown stops every listener",
+			stop: func(srv HTTPServer) error {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				defer cancel()
+				return srv.Shutdown(ctx)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New()
+			listeners := []*pipeListener{newPipeListener(), newPipeListener()}
+			served := make(chan error, len(listeners))
+			for _, l := range listeners {
+				go func() {
+					served <- srv.Serve(l, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						_, _ = io.WriteString(w, "ok")
+					}))
+				}()
+			}
+
+			// оба Serve работают: каждый слушатель отвечает на запрос
+			for _, l := range listeners {
+				c := client.New(client.WithDialContext(l.DialContext))
+				req, err := http.NewRequest(http.MethodGet, "http://myhttp.test/", nil)
+				require.NoError(t, err)
+				resp, err := c.Do(req)
+				require.NoError(t, err)
+				_, _ = io.Copy(io.Discard, resp.Body)
+				require.NoError(t, resp.Body.Close())
+			}
+
+			require.NoError(t, tt.stop(srv))
+			for range listeners {
+				select {
+				case err := <-served:
+					assert.ErrorIs(t, err, http.ErrServerClosed)
+				case <-time.After(2 * time.Second):
+					t.Fatal("Serve did not return after the server was stopped")
+				}
+			}
+			for _, l := range listeners {
+				select {
+				case <-l.closed:
+				default:
+					t.Error("listener was not closed")
+				}
+			}
+		})
+	}
+}
+
+// pipeListener - listener в памяти: DialContext отдает клиенту один конец net.Pipe, Accept - другой
+type pipeListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+func (l *pipeListener) DialContext(ctx context.Context, _, _ string) (net.Conn, error) {
+	server, conn := net.Pipe()
+	select {
+	case l.conns <- server:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+func Test_myServer_Shutdown(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerWait time.Duration
+		timeout     time.Duration
+		wantErr     error
+		wantBody    string
+	}{
+		{
+			name:        "success: in-flight request completes",
+			handlerWait: 200 * time.Millisecond,
+			timeout:     5 * time.Second,
+			wantBody:    "done",
+		},
+		{
+			name:        "error: deadline force-closes active connection",
+			handlerWait: 5 * time.Second,
+			timeout:     100 * time.Millisecond,
+			wantErr:     context.DeadlineExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/idle" {
+					return
+				}
+				close(started)
+				select {
+				case <-time.After(tt.handlerWait):
+				case <-r.Context().Done():
+				}
+				_, _ = w.Write([]byte("done"))
+			})
+			srv := New()
+			addr, closeServer := startServer(t, srv, handler)
+			defer closeServer()
+
+			// простаивающее keep-alive соединение Shutdown должен закрыть сразу
+			idle, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer idle.Close()
+			_, err = idle.Write([]byte("GET /idle HTTP/1.1\r\nHost: localhost\r\nConnection: keep-alive\r\n\r\n"))
+			require.NoError(t, err)
+
+			active, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer active.Close()
+			_ = active.SetDeadline(time.Now().Add(10 * time.Second))
+
+			idleBr := bufio.NewReader(idle)
+			resp, err := convert.ParseResponse(idleBr)
+			require.NoError(t, err)
+			_, _ = io.ReadAll(resp.Body)
+
+			_, err = active.Write([]byte("GET /active HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			<-started
+
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+			err = srv.Shutdown(ctx)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			_ = idle.SetDeadline(time.Now().Add(time.Second))
+			_, err = idleBr.ReadByte()
+			assert.ErrorIs(t, err, io.EOF)
+
+			resp, err = convert.ParseResponse(bufio.NewReader(active))
+			if tt.wantBody == "" {
+				assert.Error(t, err)
+			} else {
+				require.NoError(t, err)
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.wantBody, string(body))
+				assert.True(t, resp.Close)
+			}
+
+			_, err = net.Dial("tcp", addr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func Test_myServer_Limits(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		send       func(t *testing.T, conn net.Conn)
+		wantStatus int
+		wantClosed bool
+	}{
+		{
+			name: "success: headers within limits",
+			opts: []Option{WithReadHeaderTimeout(time.Second), WithMaxHeaderBytes(1024)},
+			send: func(t *testing.T, conn net.Conn) {
+				_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nX-Small: " + strings.Repeat("a", 100) + "\r\n\r\n"))
+				require.NoError(t, err)
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "error: slowloris headers time out",
+			opts: []Option{WithReadHeaderTimeout(200 * time.Millisecond)},
+			send: func(t *testing.T, conn net.Conn) {
+				_, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n"))
+				require.NoError(t, err)
+				for i := 0; i < 5; i++ {
+					time.Sleep(100 * time.Millisecond)
+					if _, err := conn.Write([]byte("X-Slow: a\r\n")); err != nil {
+						return
+					}
+				}
+			},
+			wantStatus: http.StatusRequestTimeout,
+			wantClosed: true,
+		},
+		{
+			name: "error: headers too large",
+			opts: []Option{WithMaxHeaderBytes(1024)},
+			send: func(t *testing.T, conn net.Conn) {
+				_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nX-Big: " + strings.Repeat("a", 16<<10) + "\r\n\r\n"))
+			},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+			wantClosed: true,
+		},
+		{
+			name: "error: trailer too large",
+			send: func(t *testing.T, conn net.Conn) {
+				// трейлер читается вместе с телом, уже после того как запрос дошел до обработчика
+				go func() {
+					_, _ = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+						"3\r\nabc\r\n0\r\nX-Big: " + strings.Repeat("a", 1<<20+1024) + "\r\n\r\n"))
+				}()
+			},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+			wantClosed: true,
+		},
+		{
+			name: "error: trailer exceeds max header bytes",
+			opts: []Option{WithMaxHeaderBytes(1024)},
+			send: func(t *testing.T, conn net.Conn) {
+				_, _ = conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n" +
+					"3\r\nabc\r\n0\r\nX-Big: " + strings.Repeat("a", 4<<10) + "\r\n\r\n"))
+			},
+			wantStatus: http.StatusRequestHeaderFieldsTooLarge,
+			wantClosed: true,
+		},
+		{
+			name: "error: slow body hits read timeout",
+			opts: []Option{WithReadTimeout(200 * time.Millisecond)},
+			send: func(t *testing.T, conn net.Conn) {
+				_, err := conn.Write([]byte("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 10\r\n\r\nabc"))
+				require.NoError(t, err)
+			},
+			wantStatus: http.StatusRequestTimeout,
+			wantClosed: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusRequestTimeout)
+				}
+			})
+			addr, closeServer := startServer(t, New(tt.opts...), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			tt.send(t, conn)
+			resp, err := convert.ParseResponse(bufio.NewReader(conn))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantClosed, resp.Close)
+		})
+	}
+}
+
+func Test_myServer_Streaming(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		contentLength string
+		wantChunked   bool
+		wantEvents    []string
+	}{
+		{
+			name:        "success: flushed segments arrive as chunks",
+			method:      http.MethodGet,
+			wantChunked: true,
+			wantEvents:  []string{"data: 1\n\n", "data: 2\n\n", "data: 3\n\n"},
+		},
+		{
+			name:          "success: declared content length is streamed as is",
+			method:        http.MethodGet,
+			contentLength: "27",
+			wantEvents:    []string{"data: 1\n\n", "data: 2\n\n", "data: 3\n\n"},
+		},
+		{
+			name:        "success: HEAD gets headers only",
+			method:      http.MethodHead,
+			wantChunked: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := make(chan struct{})
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/events" {
+					_, _ = w.Write([]byte("after"))
+					return
+				}
+				w.Header().Set("Content-Type", "text/event-stream")
+				if tt.contentLength != "" {
+					w.Header().Set("Content-Length", tt.contentLength)
+				}
+				for i := 1; i <= 3; i++ {
+					_, _ = fmt.Fprintf(w, "data: %d\n\n", i)
+					w.(http.Flusher).Flush()
+					// следующее событие пишем только после того, как клиент получил предыдущее
+					if r.Method != http.MethodHead {
+						<-next
+					}
+				}
+			})
+			addr, closeServer := startServer(t, New(), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = fmt.Fprintf(conn, "%s /events HTTP/1.1\r\nHost: localhost\r\n\r\n", tt.method)
+			require.NoError(t, err)
+			br := bufio.NewReader(conn)
+			resp, err := convert.ParseResponse(br)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+			assert.Equal(t, tt.wantChunked, len(resp.TransferEncoding) > 0)
+
+			if tt.method == http.MethodHead {
+				resp.Body = http.NoBody
+			}
+			for _, want := range tt.wantEvents {
+				buf := make([]byte, len(want))
+				_, err := io.ReadFull(resp.Body, buf)
+				require.NoError(t, err)
+				assert.Equal(t, want, string(buf))
+				next <- struct{}{}
+			}
+			rest, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Empty(t, rest)
+
+			// после потокового ответа соединение остается пригодным для следующего запроса
+			_, err = conn.Write([]byte("GET /after HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			resp, err = convert.ParseResponse(br)
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "after", string(body))
+		})
+	}
+}
+
+func Test_myServer_LargeBodyStreams(t *testing.T) {
+	tests := []struct {
+		name          string
+		contentLength bool
+		wantChunked   bool
+	}{
+		{
+			name:        "success: without length - chunked",
+			wantChunked: true,
+		},
+		{
+			name:          "success: declared length is kept",
+			contentLength: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment := bytes.Repeat([]byte("x"), maxBufferedBody)
+			received := make(chan struct{})
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentLength {
+					w.Header().Set("Content-Length", strconv.Itoa(2*len(segment)))
+				}
+				// без Flush: второй сегмент не влезает в буфер, и ответ должен уйти сам
+				_, _ = w.Write(segment)
+				_, _ = w.Write(segment)
+				// клиент получает начало тела, пока обработчик еще работает
+				<-received
+			})
+			addr, closeServer := startServer(t, New(), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+			br := bufio.NewReader(conn)
+			resp, err := convert.ParseResponse(br)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantChunked, len(resp.TransferEncoding) > 0)
+
+			head := make([]byte, len(segment))
+			_, err = io.ReadFull(resp.Body, head)
+			require.NoError(t, err)
+			close(received)
+			rest, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, len(segment), len(rest))
+		})
+	}
+}
+
+func Test_myServer_Hijack(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		// как и в чате, соединением дальше занимаются отдельные горутины, а обработчик сразу выходит
+		go func() {
+			defer ws.Close()
+			for {
+				mt, msg, err := ws.ReadMessage()
+				if err != nil {
+					return
+				}
+				if err := ws.WriteMessage(mt, msg); err != nil {
+					return
+				}
+			}
+		}()
+	})
+
+	srv := New(WithIdleTimeout(100 * time.Millisecond))
+	addr, closeServer := startServer(t, srv, handler)
+	defer closeServer()
+
+	ws, resp, err := websocket.DefaultDialer.Dial("ws://"+addr+"/ws", nil)
+	require.NoError(t, err)
+	defer ws.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	echo := func() {
+		require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+		require.NoError(t, ws.WriteMessage(websocket.TextMessage, []byte("hello")))
+		mt, msg, err := ws.ReadMessage()
+		require.NoError(t, err)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, "hello", string(msg))
+	}
+	echo()
+
+	// на забранное соединение не действуют ни таймауты сервера, ни его Shutdown
+	time.Sleep(300 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+	echo()
+}
+
+func Test_myServer_Hooks(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/stream":
+			_, _ = io.WriteString(w, "part1 ")
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, "part2")
+		case "/created":
+			w.WriteHeader(http.StatusCreated)
+		case "/panic":
+			panic("boom")
+		case "/hijack":
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+		default:
+			_, _ = io.WriteString(w, "hello")
+		}
+	})
+
+	tests := []struct {
+		name       string
+		requests   []string
+		wantInfo   []RequestInfo
+		wantStates []http.ConnState
+	}{
+		{
+			name:       "success: keep-alive requests",
+			requests:   []string{"/hello", "/created"},
+			wantInfo:   []RequestInfo{{StatusCode: http.StatusOK, BytesWritten: 5}, {StatusCode: http.StatusCreated}},
+			wantStates: []http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateActive, http.StateIdle, http.StateClosed},
+		},
+		{
+			name:       "success: streamed response",
+			requests:   []string{"/stream"},
+			wantInfo:   []RequestInfo{{StatusCode: http.StatusOK, BytesWritten: 11}},
+			wantStates: []http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateClosed},
+		},
+		{
+			name:       "error: handler panic sends no response",
+			requests:   []string{"/panic"},
+			wantInfo:   []RequestInfo{{}},
+			wantStates: []http.ConnState{http.StateNew, http.StateActive, http.StateClosed},
+		},
+		{
+			name:       "success: hijacked connection",
+			requests:   []string{"/hijack"},
+			wantInfo:   []RequestInfo{{}},
+			wantStates: []http.ConnState{http.StateNew, http.StateActive, http.StateHijacked},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				states  []http.ConnState
+				started []string
+				infos   []RequestInfo
+			)
+			srv := New(
+				WithConnState(func(_ net.Conn, state http.ConnState) {
+					mu.Lock()
+					defer mu.Unlock()
+					states = append(states, state)
+				}),
+				WithRequestHooks(func(r *http.Request) {
+					mu.Lock()
+					defer mu.Unlock()
+					started = append(started, r.URL.Path)
+				}, func(r *http.Request, info RequestInfo) {
+					assert.Positive(t, info.Duration)
+					info.Duration = 0
+					mu.Lock()
+					defer mu.Unlock()
+					infos = append(infos, info)
+				}),
+			)
+			addr, closeServer := startServer(t, srv, handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			br := bufio.NewReader(conn)
+			for _, path := range tt.requests {
+				_, err := fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\n\r\n", path)
+				require.NoError(t, err)
+				resp, err := convert.ParseResponse(br)
+				if err != nil {
+					// на панику и hijack сервер просто закрывает соединение
+					break
+				}
+				_, err = io.ReadAll(resp.Body)
+				require.NoError(t, err)
+			}
+			require.NoError(t, conn.Close())
+
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(states) == len(tt.wantStates) && len(infos) == len(tt.wantInfo)
+			}, time.Second, 5*time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			assert.Equal(t, tt.wantStates, states)
+			assert.Equal(t, tt.requests, started)
+			assert.Equal(t, tt.wantInfo, infos)
+		})
+	}
+}
+
+func Test_myServer_ListenAndServeTLS(t *testing.T) {
+	ca := newTestCA(t)
+	serverCert := ca.issue(t, "myhttp server", x509.ExtKeyUsageServerAuth, "localhost", "myhttp.test")
+	clientCert := ca.issue(t, "myhttp client", x509.ExtKeyUsageClientAuth)
+	certFile, keyFile := writeKeyPair(t, serverCert)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			http.Error(w, "plain connection", http.StatusBadRequest)
+			return
+		}
+		peer := "anonymous"
+		if len(r.TLS.PeerCertificates) > 0 {
+			peer = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+		_, _ = fmt.Fprintf(w, "%s %s", r.TLS.ServerName, peer)
+	})
+
+	tests := []struct {
+		name      string
+		serverTLS *tls.Config
+		clientTLS *tls.Config
+		host      string // req.Host, если отличается от адреса из URL
+		wantBody  string
+		wantErr   string
+	}{
+		{
+			name:      "success: server trusted via custom roots",
+			clientTLS: &tls.Config{RootCAs: ca.pool},
+			wantBody:  "localhost anonymous",
+		},
+		{
+			name:      "success: SNI is taken from req.Host",
+			clientTLS: &tls.Config{RootCAs: ca.pool},
+			host:      "myhttp.test",
+			wantBody:  "myhttp.test anonymous",
+		},
+		{
+			name:      "success: mutual TLS",
+			serverTLS: &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: ca.pool},
+			clientTLS: &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{clientCert}},
+			wantBody:  "localhost myhttp client",
+		},
+		{
+			name:    "error: unknown certificate authority",
+			wantErr: "certificate signed by unknown authority",
+		},
+		{
+			name:      "error: client certificate required",
+			serverTLS: &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: ca.pool},
+			clientTLS: &tls.Config{RootCAs: ca.pool},
+			wantErr:   "certificate required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var srvOpts []Option
+			if tt.serverTLS != nil {
+				srvOpts = append(srvOpts, WithTLSConfig(tt.serverTLS))
+			}
+			srv := New(srvOpts...)
+			port, err := freeport.GetFreePort()
+			require.NoError(t, err)
+			go func() {
+				_ = srv.ListenAndServeTLS(fmt.Sprintf("localhost:%v", port), certFile, keyFile, handler)
+			}()
+			defer srv.Close()
+			time.Sleep(100 * time.Millisecond)
+
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://localhost:%v/", port), nil)
+			require.NoError(t, err)
+			if tt.host != "" {
+				// ходим по IP, чтобы имя сервера бралось из req.Host, а не из адреса
+				req.URL.Host = fmt.Sprintf("127.0.0.1:%v", port)
+				req.Host = tt.host
+			}
+			var clientOpts []client.Option
+			if tt.clientTLS != nil {
+				clientOpts = append(clientOpts, client.WithTLSConfig(tt.clientTLS))
+			}
+			resp, err := client.New(clientOpts...).Do(req)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.NotNil(t, resp.TLS)
+			assert.Equal(t, "http/1.1", resp.TLS.NegotiatedProtocol)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(body))
+		})
+	}
+
+	t.Run("error: no certificate", func(t *testing.T) {
+		err := New().ListenAndServeTLS("localhost:0", "", "", handler)
+		assert.ErrorContains(t, err, "no TLS certificate")
+	})
+
+	t.Run("error: plain HTTP to TLS port", func(t *testing.T) {
+		srv := New()
+		port, err := freeport.GetFreePort()
+		require.NoError(t, err)
+		go func() {
+			_ = srv.ListenAndServeTLS(fmt.Sprintf("localhost:%v", port), certFile, keyFile, handler)
+		}()
+		defer srv.Close()
+		time.Sleep(100 * time.Millisecond)
+
+		_, err = client.New().Do(&http.Request{
+			URL: &url.URL{Scheme: "http", Host: fmt.Sprintf("localhost:%v", port), Path: "/"},
+		})
+		assert.Error(t, err)
+	})
+}
+
+// testCA - самоподписанный удостоверяющий центр, которым тесты подписывают сертификаты
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "myhttp test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue выпускает сертификат, подписанный CA
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage, dnsNames ...string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dnsNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writeKeyPair сохраняет сертификат и ключ в PEM-файлы для ListenAndServeTLS
+func writeKeyPair(t *testing.T, cert tls.Certificate) (certFile, keyFile string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Certificate[0]}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile
+}
+
+func Test_myServer_Compression(t *testing.T) {
+	large := strings.Repeat(`{"greeting": "Hello, World!"}`, 100)
+
+	// withETag добавляет к ответу сильный ETag, как это делает static
+	withETag := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			next(w, r)
+		}
+	}
+	// setCompression переключает сжатие ответа из-под обертки middleware
+	setCompression := func(enabled bool, next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			require.True(t, SetCompression(unwrapWriter{w}, enabled))
+			next(w, r)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		opts           []Option
+		acceptEncoding string
+		handler        http.HandlerFunc
+		wantEncoding   string
+		wantVary       bool
+		wantChunked    bool
+		wantETag       string
+		wantBody       string
+	}{
+		{
+			name:           "success: large JSON is gzipped",
+			acceptEncoding: "gzip, deflate",
+			handler:        writeBody("application/json", large),
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:           "success: deflate when gzip is refused",
+			acceptEncoding: "gzip;q=0, deflate",
+			handler:        writeBody("text/plain; charset=utf-8", large),
+			wantEncoding:   "deflate",
+			wantVary:       true,
+			wantBody:       large,
+		},
+		{
+			name:     "success: client without Accept-Encoding gets plain body",
+			handler:  writeBody("application/json", large),
+			wantVary: true,
+			wantBody: large,
+		},
+		{
+			name:           "success: small body is not compressed",
+			acceptEncoding: "gzip",
+			handler:        writeBody("application/json", `{"ok": true}`),
+			wantVary:       true,
+			wantBody:       `{"ok": true}`,
+		},
+		{
+			name:           "success: binary content is not compressed",
+			acceptEncoding: "gzip",
+			handler:        writeBody("image/png", large),
+			wantBody:       large,
+		},
+		{
+			name:           "success: handler's own encoding is kept",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "identity")
+				writeBody("application/json", large)(w, r)
+			},
+			wantEncoding: "identity",
+			wantBody:     large,
+		},
+		{
+			name:           "success: flushed stream is gzipped",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				for i := 0; i < 3; i++ {
+					_, _ = fmt.Fprintf(w, "data: %d\n\n", i)
+					w.(http.Flusher).Flush()
+				}
+			},
+			wantEncoding: "gzip",
+			wantVary:     true,
+			wantChunked:  true,
+			wantBody:     "data: 0\n\ndata: 1\n\ndata: 2\n\n",
+		},
+		{
+			name:           "success: etag of compressed body is weakened",
+			acceptEncoding: "gzip",
+			handler:        withETag(writeBody("application/json", large)),
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantETag:       `W/"v1"`,
+			wantBody:       large,
+		},
+		{
+			name:           "success: etag of flushed compressed stream is weakened",
+			acceptEncoding: "gzip",
+			handler: withETag(func(w http.ResponseWriter, r *http.Request) {
+				writeBody("text/plain", "streamed")(w, r)
+				w.(http.Flusher).Flush()
+			}),
+			wantEncoding: "gzip",
+			wantVary:     true,
+			wantChunked:  true,
+			wantETag:     `W/"v1"`,
+			wantBody:     "streamed",
+		},
+		{
+			name:           "success: etag of plain body stays strong",
+			acceptEncoding: "gzip",
+			handler:        withETag(writeBody("application/json", `{"ok": true}`)),
+			wantVary:       true,
+			wantETag:       `"v1"`,
+			wantBody:       `{"ok": true}`,
+		},
+		{
+			name:           "success: compression disabled for one response",
+			acceptEncoding: "gzip",
+			handler:        setCompression(false, writeBody("application/json", large)),
+			wantBody:       large,
+		},
+		{
+			name:           "success: compression enabled for one response",
+			opts:           []Option{}, // сжатие на сервере выключено
+			acceptEncoding: "gzip",
+			handler:        setCompression(true, writeBody("application/json", large)),
+			wantEncoding:   "gzip",
+			wantVary:       true,
+			wantBody:       large,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			if opts == nil {
+				opts = []Option{WithCompression(0)}
+			}
+			addr, closeServer := startServer(t, New(opts...), tt.handler)
+			defer closeServer()
+
+			req, err := http.NewRequest(http.MethodGet, "http://"+addr+"/", nil)
+			require.NoError(t, err)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			// сырой ответ, без прозрачной распаковки
+			c := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.wantEncoding, resp.Header.Get("Content-Encoding"))
+			assert.Equal(t, tt.wantVary, resp.Header.Get("Vary") == "Accept-Encoding")
+			assert.Equal(t, tt.wantChunked, len(resp.TransferEncoding) > 0)
+			assert.Equal(t, tt.wantETag, resp.Header.Get("ETag"))
+
+			var body io.ReadCloser = resp.Body
+			if convert.IsSupportedEncoding(tt.wantEncoding) {
+				body, err = convert.NewDecodingReader(resp.Body, tt.wantEncoding)
+				require.NoError(t, err)
+			}
+			got, err := io.ReadAll(body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(got))
+		})
+	}
+}
+
+func Test_myServer_CompressedStreamChunks(t *testing.T) {
+	const flushes = 3
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for i := range flushes {
+			_, _ = fmt.Fprintf(w, "data: %d\n\n", i)
+			w.(http.Flusher).Flush()
+		}
+	})
+
+	tests := []struct {
+		name     string
+		encoding string
+	}{
+		{name: "success: gzip", encoding: "gzip"},
+		{name: "success: deflate", encoding: "deflate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(WithCompression(0)), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nAccept-Encoding: %s\r\n\r\n", tt.encoding)
+			require.NoError(t, err)
+			br := bufio.NewReader(conn)
+			tp := textproto.NewReader(br)
+			_, err = tp.ReadLine()
+			require.NoError(t, err)
+			header, err := tp.ReadMIMEHeader()
+			require.NoError(t, err)
+			require.Equal(t, tt.encoding, header.Get("Content-Encoding"))
+
+			// разбираем чанки вручную, чтобы видеть, как тело поделено на проводе
+			var chunks int
+			var body bytes.Buffer
+			for {
+				line, err := tp.ReadLine()
+				require.NoError(t, err)
+				size, err := strconv.ParseInt(line, 16, 64)
+				require.NoError(t, err)
+				if size == 0 {
+					break
+				}
+				chunks++
+				_, err = io.CopyN(&body, br, size+int64(len("\r\n")))
+				require.NoError(t, err)
+				body.Truncate(body.Len() - len("\r\n"))
+			}
+			// по чанку на каждый Flush и один на конец сжатого потока
+			assert.Equal(t, flushes+1, chunks)
+
+			dec, err := convert.NewDecodingReader(io.NopCloser(&body), tt.encoding)
+			require.NoError(t, err)
+			got, err := io.ReadAll(dec)
+			require.NoError(t, err)
+			assert.Equal(t, "data: 0\n\ndata: 1\n\ndata: 2\n\n", string(got))
+		})
+	}
+}
+
+// unwrapWriter - обертка middleware над writer'ом сервера
+type unwrapWriter struct {
+	http.ResponseWriter
+}
+
+func (w unwrapWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func writeBody(contentType, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = io.WriteString(w, body)
+	}
+}
+
+func Test_myServer_Trailers(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		wantChunked bool
+		wantTrailer http.Header
+	}{
+		{
+			name: "success: announced trailer",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "X-Checksum")
+				_, _ = io.WriteString(w, "hello")
+				w.Header().Set("X-Checksum", "abc")
+			},
+			wantChunked: true,
+			wantTrailer: http.Header{"X-Checksum": {"abc"}},
+		},
+		{
+			name: "success: announced trailer after flush",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+				_, _ = io.WriteString(w, "hel")
+				w.(http.Flusher).Flush()
+				_, _ = io.WriteString(w, "lo")
+				w.Header().Set("Grpc-Status", "0")
+				w.Header().Set("Grpc-Message", "ok")
+			},
+			wantChunked: true,
+			wantTrailer: http.Header{"Grpc-Status": {"0"}, "Grpc-Message": {"ok"}},
+		},
+		{
+			name: "success: TrailerPrefix",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "hello")
+				w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+			},
+			wantChunked: true,
+			wantTrailer: http.Header{"X-Checksum": {"abc"}},
+		},
+		{
+			name: "success: TrailerPrefix after flush",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "hel")
+				w.(http.Flusher).Flush()
+				_, _ = io.WriteString(w, "lo")
+				w.Header().Set(http.TrailerPrefix+"X-Checksum", "abc")
+			},
+			wantChunked: true,
+			wantTrailer: http.Header{"X-Checksum": {"abc"}},
+		},
+		{
+			name:        "success: no trailer keeps Content-Length",
+			handler:     writeBody("text/plain", "hello"),
+			wantTrailer: http.Header{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(), tt.handler)
+			defer closeServer()
+
+			resp, err := http.Get("http://" + addr + "/")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantChunked, len(resp.TransferEncoding) > 0)
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "hello", string(body))
+			trailer := resp.Trailer
+			if trailer == nil {
+				trailer = http.Header{}
+			}
+			assert.Equal(t, tt.wantTrailer, trailer)
+		})
+	}
+
+	t.Run("success: handler sees request trailer after body", func(t *testing.T) {
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			before := r.Trailer.Get("X-Checksum")
+			body, _ := io.ReadAll(r.Body)
+			_, _ = fmt.Fprintf(w, "%s %q %q", body, before, r.Trailer.Get("X-Checksum"))
+		})
+		addr, closeServer := startServer(t, New(), handler)
+		defer closeServer()
+
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/", strings.NewReader("hello"))
+		require.NoError(t, err)
+		req.ContentLength = -1
+		req.Trailer = http.Header{"X-Checksum": {"abc"}}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, `hello "" "abc"`, string(body))
+	})
+}
+
+func Test_myServer_ExpectContinue(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			if r.Header.Get("X-Read-Body") != "" {
+				_, _ = io.Copy(io.Discard, r.Body)
+			}
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	})
+
+	tests := []struct {
+		name         string
+		header       string
+		wantContinue bool
+		// sendBodyLate - клиент не дождался 100 Continue и отправляет тело сам
+		sendBodyLate bool
+		wantStatus   int
+		wantBody     string
+		wantClose    bool
+	}{
+		{
+			name:         "success: 100 Continue when handler reads body",
+			header:       "Expect: 100-continue\r\nAuthorization: Bearer token\r\n",
+			wantContinue: true,
+			wantStatus:   http.StatusOK,
+			wantBody:     "hello",
+		},
+		{
+			name:       "success: no 100 Continue when handler replies first",
+			header:     "Expect: 100-continue\r\n",
+			wantStatus: http.StatusUnauthorized,
+			wantClose:  true,
+		},
+		{
+			name:         "success: no 100 Continue when handler reads body after final status",
+			header:       "Expect: 100-continue\r\nX-Read-Body: 1\r\n",
+			sendBodyLate: true,
+			wantStatus:   http.StatusUnauthorized,
+			wantClose:    true,
+		},
+		{
+			name:       "error: unknown expectation",
+			header:     "Expect: 200-ok\r\nAuthorization: Bearer token\r\n",
+			wantStatus: http.StatusExpectationFailed,
+			wantBody:   "Expectation Failed\n",
+			wantClose:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(), handler)
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = fmt.Fprintf(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 5\r\n%s\r\n", tt.header)
+			require.NoError(t, err)
+			if tt.sendBodyLate {
+				time.Sleep(100 * time.Millisecond)
+				_, err = io.WriteString(conn, "hello")
+				require.NoError(t, err)
+			}
+			br := bufio.NewReader(conn)
+			resp, err := convert.ParseResponse(br)
+			require.NoError(t, err)
+			if tt.wantContinue {
+				require.Equal(t, http.StatusContinue, resp.StatusCode)
+				_, err = io.WriteString(conn, "hello")
+				require.NoError(t, err)
+				resp, err = convert.ParseResponse(br)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantClose, resp.Close)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBody, string(body))
+
+			if tt.wantClose {
+				_, err = br.ReadByte()
+				assert.ErrorIs(t, err, io.EOF)
+				return
+			}
+			// после обмена с 100 Continue соединение пригодно для следующего запроса
+			_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nAuthorization: Bearer token\r\nContent-Length: 3\r\n\r\nbye")
+			require.NoError(t, err)
+			resp, err = convert.ParseResponse(br)
+			require.NoError(t, err)
+			body, err = io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "bye", string(body))
+		})
+	}
+}
+
+func Test_myServer_MalformedRequests(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		request    string
+		wantStatus int
+	}{
+		{
+			name:       "error: Content-Length with Transfer-Encoding",
+			request:    "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: duplicate Content-Length",
+			request:    "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\nContent-Length: 3\r\n\r\nabc",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: obs-fold",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\nX-Folded: a\r\n\tb\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: bare LF with strict line endings",
+			opts:       []Option{WithStrictLineEndings()},
+			request:    "GET / HTTP/1.1\nHost: localhost\n\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: unsupported Transfer-Encoding",
+			request:    "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: gzip\r\n\r\n",
+			wantStatus: http.StatusNotImplemented,
+		},
+		{
+			name:       "error: missing Host",
+			request:    "GET / HTTP/1.1\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: duplicate Host",
+			request:    "GET / HTTP/1.1\r\nHost: localhost\r\nHost: example.com\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "success: OPTIONS in asterisk-form",
+			request:    "OPTIONS * HTTP/1.1\r\nHost: localhost\r\n\r\n",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "error: Transfer-Encoding in HTTP/1.0",
+			request:    "POST / HTTP/1.0\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "error: unsupported version",
+			request:    "GET / HTTP/1.2\r\nHost: localhost\r\n\r\n",
+			wantStatus: http.StatusHTTPVersionNotSupported,
+		},
+		{
+			name:       "success: bare LF without strict line endings",
+			request:    "GET / HTTP/1.1\nHost: localhost\n\n",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr, closeServer := startServer(t, New(tt.opts...), writeBody("text/plain", "ok"))
+			defer closeServer()
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			_, err = io.WriteString(conn, tt.request)
+			require.NoError(t, err)
+			resp, err := convert.ParseResponse(bufio.NewReader(conn))
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			// после ошибки разбора граница следующего запроса неизвестна, соединение закрывается
+			assert.Equal(t, tt.wantStatus != http.StatusOK, resp.Close)
+		})
+	}
+}
+
+func Test_myServer_Forms(t *testing.T) {
+	multipartBody := func(t *testing.T, fileSize int) (io.Reader, string) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		require.NoError(t, mw.WriteField("name", "gopher"))
+		part, err := mw.CreateFormFile("file", "data.bin")
+		require.NoError(t, err)
+		_, err = part.Write(bytes.Repeat([]byte("x"), fileSize))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+		return &buf, mw.FormDataContentType()
+	}
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		body       func(t *testing.T) (io.Reader, string)
+		wantStatus int
+		wantBody   string
+		wantSpill  bool
+	}{
+		{
+			name: "success: urlencoded form",
+			body: func(t *testing.T) (io.Reader, string) {
+				return strings.NewReader("name=gopher&size=0"), "application/x-www-form-urlencoded"
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "gopher 0 false",
+		},
+		{
+			name: "success: multipart form parsed by handler",
+			body: func(t *testing.T) (io.Reader, string) {
+				return multipartBody(t, 100)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "gopher 100 false",
+		},
+		{
+			name: "success: large file spills to temp file",
+			opts: []Option{WithMaxMultipartMemory(1024)},
+			body: func(t *testing.T) (io.Reader, string) {
+				return multipartBody(t, 64<<10)
+			},
+			wantStatus: http.StatusOK,
+			wantBody:   "gopher 65536 true",
+			wantSpill:  true,
+		},
+		{
+			name: "error: malformed multipart form",
+			opts: []Option{WithMaxMultipartMemory(1024)},
+			body: func(t *testing.T) (io.Reader, string) {
+				return strings.NewReader("not a multipart body"), "multipart/form-data; boundary=xyz"
+			},
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "Bad Request\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tempFile atomic.Value
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				size, spilled := "0", false
+				if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+					f, h, err := r.FormFile("file")
+					if err != nil {
+						http.Error(w, err.Error(), http.StatusBadRequest)
+						return
+					}
+					defer f.Close()
+					size = strconv.FormatInt(h.Size, 10)
+					if osFile, ok := f.(*os.File); ok {
+						spilled = true
+						tempFile.Store(osFile.Name())
+					}
+				} else {
+					size = r.PostFormValue("size")
+				}
+				_, _ = fmt.Fprintf(w, "%s %s %v", r.FormValue("name"), size, spilled)
+			})
+			addr, closeServer := startServer(t, New(tt.opts...), handler)
+			defer closeServer()
+
+			body, contentType := tt.body(t)
+			resp, err := http.Post("http://"+addr+"/", contentType, body)
+			require.NoError(t, err)
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantBody, string(got))
+
+			if tt.wantSpill {
+				name, _ := tempFile.Load().(string)
+				require.NotEmpty(t, name)
+				// после ответа сервер удаляет временные файлы формы
+				assert.Eventually(t, func() bool {
+					_, err := os.Stat(name)
+					return os.IsNotExist(err)
+				}, time.Second, 10*time.Millisecond)
+			}
+		})
+	}
+}
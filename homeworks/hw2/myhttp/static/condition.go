@@ -0,0 +1,184 @@
+package static
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// condResult - итог проверки одного условного заголовка
+type condResult int
+
+const (
+	condNone  condResult = iota // заголовка нет или его нельзя проверить
+	condTrue                    // условие выполнено
+	condFalse                   // условие не выполнено
+)
+
+// checkPreconditions проверяет условные заголовки в порядке RFC 9110, 13.2.2. done - ответ
+// уже отправлен (304 или 412); rangeHeader - значение Range, если его нужно учитывать.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, etag string, modtime time.Time) (done bool, rangeHeader string) {
+	ch := checkIfMatch(r, etag)
+	if ch == condNone {
+		ch = checkIfUnmodifiedSince(r, modtime)
+	}
+	if ch == condFalse {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return true, ""
+	}
+
+	switch checkIfNoneMatch(r, etag) {
+	case condFalse:
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			writeNotModified(w)
+		} else {
+			w.WriteHeader(http.StatusPreconditionFailed)
+		}
+		return true, ""
+	case condNone:
+		if checkIfModifiedSince(r, modtime) == condFalse {
+			writeNotModified(w)
+			return true, ""
+		}
+	}
+
+	rangeHeader = r.Header.Get("Range")
+	if rangeHeader != "" && checkIfRange(r, etag, modtime) == condFalse {
+		rangeHeader = ""
+	}
+	return false, rangeHeader
+}
+
+func checkIfMatch(r *http.Request, etag string) condResult {
+	im := r.Header.Get("If-Match")
+	if im == "" {
+		return condNone
+	}
+	if matchETag(im, etag, false) {
+		return condTrue
+	}
+	return condFalse
+}
+
+func checkIfUnmodifiedSince(r *http.Request, modtime time.Time) condResult {
+	ius := r.Header.Get("If-Unmodified-Since")
+	if ius == "" || modtime.IsZero() {
+		return condNone
+	}
+	t, err := http.ParseTime(ius)
+	if err != nil {
+		return condNone
+	}
+	// в заголовках время с точностью до секунды
+	if modtime.Truncate(time.Second).After(t) {
+		return condFalse
+	}
+	return condTrue
+}
+
+func checkIfNoneMatch(r *http.Request, etag string) condResult {
+	inm := r.Header.Get("If-None-Match")
+	if inm == "" {
+		return condNone
+	}
+	if matchETag(inm, etag, true) {
+		return condFalse
+	}
+	return condTrue
+}
+
+func checkIfModifiedSince(r *http.Request, modtime time.Time) condResult {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return condNone
+	}
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modtime.IsZero() {
+		return condNone
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return condNone
+	}
+	if modtime.Truncate(time.Second).After(t) {
+		return condTrue
+	}
+	return condFalse
+}
+
+// checkIfRange: диапазон отдается, только если клиент держит ту же версию файла.
+// Сравнение ETag строгое, дата должна совпасть точно.
+func checkIfRange(r *http.Request, etag string, modtime time.Time) condResult {
+	ir := r.Header.Get("If-Range")
+	if ir == "" {
+		return condNone
+	}
+	if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+		if matchETag(ir, etag, false) {
+			return condTrue
+		}
+		return condFalse
+	}
+	if modtime.IsZero() {
+		return condFalse
+	}
+	t, err := http.ParseTime(ir)
+	if err == nil && t.Equal(modtime.Truncate(time.Second)) {
+		return condTrue
+	}
+	return condFalse
+}
+
+// writeNotModified отвечает 304: тела нет, поэтому заголовки о нем не нужны,
+// а ETag и Last-Modified остаются
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Del("Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// matchETag сообщает, есть ли etag в списке list из If-Match, If-None-Match или If-Range;
+// "*" совпадает с любым существующим файлом. weak - слабое сравнение без учета W/, как требует
+// If-None-Match; при сильном слабые теги не совпадают ни с чем.
+func matchETag(list, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return false
+		}
+		if list[0] == '*' {
+			return true
+		}
+		tag, rest, ok := cutETag(list)
+		if !ok {
+			return false
+		}
+		if weak {
+			if strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(tag, "W/") && tag == etag {
+			return true
+		}
+		list = rest
+	}
+}
+
+// cutETag отрезает от s первый entity-tag: "..." или W/"...". Запятая внутри кавычек
+// допустима, поэтому список нельзя просто разбить по запятым.
+func cutETag(s string) (tag, rest string, ok bool) {
+	opaque := strings.TrimPrefix(s, "W/")
+	if len(opaque) < 2 || opaque[0] != '"' {
+		return "", "", false
+	}
+	end := strings.IndexByte(opaque[1:], '"')
+	if end < 0 {
+		return "", "", false
+	}
+	n := len(s) - len(opaque) + end + 2
+	return s[:n], s[n:], true
+}
@@ -0,0 +1,16 @@
+package static
+
+// Option настраивает файловый сервер, созданный New
+type Option func(*options)
+
+type options struct {
+	listDirectories bool
+}
+
+// WithDirectoryListing включает список файлов для каталогов без index.html.
+// Без него такие каталоги отвечают 404, чтобы не раскрывать их содержимое.
+func WithDirectoryListing() Option {
+	return func(o *options) {
+		o.listDirectories = true
+	}
+}
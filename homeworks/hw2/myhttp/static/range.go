@@ -0,0 +1,152 @@
+package static
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// errUnsatisfiable - ни один диапазон из Range не попадает в файл
+var errUnsatisfiable = errors.New("416 Requested Range Not Satisfiable")
+
+// byteRange - отрезок файла [start, start+length)
+type byteRange struct {
+	start, length int64
+}
+
+func (r byteRange) contentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.start, r.start+r.length-1, size)
+}
+
+// parseRange разбирает заголовок Range для файла размером size (RFC 9110, 14.1.2).
+// Диапазоны за концом файла пропускаются; если не осталось ни одного - errUnsatisfiable.
+// Заголовок с другими единицами или с синтаксической ошибкой игнорируется: nil без ошибки,
+// и файл отдается целиком.
+func parseRange(header string, size int64) ([]byteRange, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok {
+		return nil, nil
+	}
+	var ranges []byteRange
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		first, last, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, nil
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		if first == "" {
+			// -N: последние N байт файла
+			n, ok := parseOffset(last)
+			if !ok {
+				return nil, nil
+			}
+			n = min(n, size)
+			if n == 0 {
+				continue
+			}
+			ranges = append(ranges, byteRange{start: size - n, length: n})
+			continue
+		}
+
+		start, ok := parseOffset(first)
+		if !ok {
+			return nil, nil
+		}
+		end := size - 1
+		if last != "" {
+			e, ok := parseOffset(last)
+			if !ok || e < start {
+				return nil, nil
+			}
+			end = min(end, e)
+		}
+		if start >= size {
+			continue
+		}
+		ranges = append(ranges, byteRange{start: start, length: end - start + 1})
+	}
+	if len(ranges) == 0 {
+		return nil, errUnsatisfiable
+	}
+	return ranges, nil
+}
+
+// parseOffset разбирает неотрицательное десятичное число без знака
+func parseOffset(s string) (int64, bool) {
+	if s == "" || strings.TrimLeft(s, "0123456789") != "" {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+func sumLength(ranges []byteRange) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.length
+	}
+	return n
+}
+
+func newBoundary() string {
+	return rand.Text()
+}
+
+// multipartSize считает длину тела multipart/byteranges, не читая файл: заголовки частей
+// пишутся в счетчик, а длины данных известны заранее. Так ответ уходит с Content-Length.
+func multipartSize(ranges []byteRange, boundary, ctype string, size int64) int64 {
+	var cw countingWriter
+	mw := multipart.NewWriter(&cw)
+	_ = mw.SetBoundary(boundary)
+	for _, ra := range ranges {
+		_, _ = mw.CreatePart(partHeader(ra, ctype, size))
+		cw += countingWriter(ra.length)
+	}
+	_ = mw.Close()
+	return int64(cw)
+}
+
+// writeRanges пишет в w тело multipart/byteranges: по части на каждый диапазон
+func writeRanges(w io.Writer, rs io.ReadSeeker, ranges []byteRange, boundary, ctype string, size int64) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, ra := range ranges {
+		part, err := mw.CreatePart(partHeader(ra, ctype, size))
+		if err != nil {
+			return err
+		}
+		if _, err := rs.Seek(ra.start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(part, rs, ra.length); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+
+func partHeader(ra byteRange, ctype string, size int64) textproto.MIMEHeader {
+	return textproto.MIMEHeader{
+		"Content-Range": {ra.contentRange(size)},
+		"Content-Type":  {ctype},
+	}
+}
+
+type countingWriter int64
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	*w += countingWriter(len(p))
+	return len(p), nil
+}
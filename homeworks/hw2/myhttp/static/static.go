@@ -0,0 +1,269 @@
+// Package static раздает файлы из fs.FS: замена http.FileServer поверх своего стека.
+// Поддерживаются Last-Modified и сильные ETag, условные запросы (RFC 9110, раздел 13)
+// и Range с одним или несколькими диапазонами.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// indexFile отдается вместо каталога, если в нем есть
+const indexFile = "index.html"
+
+// sniffLen - столько байт смотрит http.DetectContentType
+const sniffLen = 512
+
+type fileServer struct {
+	fsys fs.FS
+	opts options
+}
+
+// New возвращает обработчик, который отвечает на GET и HEAD файлом из fsys по пути запроса.
+// Чтобы раздавать файлы не от корня, обработчик можно обернуть в http.StripPrefix.
+// Диапазоны и условные запросы по ETag работают, только если файлы fsys реализуют io.Seeker
+// (так у os.DirFS, embed.FS и fstest.MapFS); иначе файл отдается целиком.
+func New(fsys fs.FS, opts ...Option) http.Handler {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &fileServer{fsys: fsys, opts: o}
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	urlPath := r.URL.Path
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	// path.Clean от абсолютного пути убирает все "..", поэтому выйти за пределы fsys нельзя
+	name := strings.TrimPrefix(path.Clean(urlPath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+
+	if info.IsDir() {
+		// относительные ссылки из index.html и списка файлов работают, только если путь кончается на /
+		if !strings.HasSuffix(urlPath, "/") {
+			localRedirect(w, r, path.Base(urlPath)+"/")
+			return
+		}
+		s.serveDir(w, r, name)
+		return
+	}
+	if strings.HasSuffix(urlPath, "/") {
+		localRedirect(w, r, "../"+path.Base(name))
+		return
+	}
+	serveContent(w, r, f, info)
+}
+
+// serveDir отдает index.html каталога, а без него - список файлов, если он включен
+func (s *fileServer) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	if f, err := s.fsys.Open(path.Join(name, indexFile)); err == nil {
+		defer f.Close()
+		if info, err := f.Stat(); err == nil && !info.IsDir() {
+			serveContent(w, r, f, info)
+			return
+		}
+	}
+	if !s.opts.listDirectories {
+		http.NotFound(w, r)
+		return
+	}
+
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		writeFSError(w, err)
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		// имя файла может содержать и HTML, и символы, значимые в URL
+		link := url.URL{Path: entryName}
+		fmt.Fprintf(&buf, "<a href=\"%s\">%s</a>\n", html.EscapeString(link.String()), html.EscapeString(entryName))
+	}
+	buf.WriteString("</pre>\n")
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = buf.WriteTo(w)
+	}
+}
+
+// serveContent отвечает содержимым файла с учетом условных заголовков и Range.
+// Тело копируется в w по частям, а не читается в память целиком.
+func serveContent(w http.ResponseWriter, r *http.Request, f fs.File, info fs.FileInfo) {
+	header := w.Header()
+	size := info.Size()
+	rs, seekable := f.(io.ReadSeeker)
+	var body io.Reader = f
+
+	ctype := mime.TypeByExtension(path.Ext(info.Name()))
+	if ctype == "" {
+		buf := make([]byte, sniffLen)
+		n, err := io.ReadFull(f, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		ctype = http.DetectContentType(buf[:n])
+		if seekable {
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+		} else {
+			body = io.MultiReader(bytes.NewReader(buf[:n]), f)
+		}
+	}
+
+	if modtime := info.ModTime(); !modtime.IsZero() {
+		header.Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+	etag, err := fileETag(f, info)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if etag != "" {
+		header.Set("ETag", etag)
+	}
+
+	done, rangeHeader := checkPreconditions(w, r, etag, info.ModTime())
+	if done {
+		return
+	}
+
+	code := http.StatusOK
+	sendSize := size
+	var ranges []byteRange
+	if seekable {
+		header.Set("Accept-Ranges", "bytes")
+		if rangeHeader != "" {
+			ranges, err = parseRange(rangeHeader, size)
+			if err != nil {
+				header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+				http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			// пересекающиеся диапазоны в сумме больше файла - дешевле отдать его целиком
+			if sumLength(ranges) > size {
+				ranges = nil
+			}
+		}
+	}
+
+	var boundary string
+	switch {
+	case len(ranges) == 1:
+		ra := ranges[0]
+		if _, err := rs.Seek(ra.start, io.SeekStart); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		code = http.StatusPartialContent
+		sendSize = ra.length
+		header.Set("Content-Range", ra.contentRange(size))
+	case len(ranges) > 1:
+		boundary = newBoundary()
+		code = http.StatusPartialContent
+		sendSize = multipartSize(ranges, boundary, ctype, size)
+	}
+
+	if boundary != "" {
+		header.Set("Content-Type", "multipart/byteranges; boundary="+boundary)
+	} else {
+		header.Set("Content-Type", ctype)
+	}
+	header.Set("Content-Length", strconv.FormatInt(sendSize, 10))
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if boundary != "" {
+		_ = writeRanges(w, rs, ranges, boundary, ctype, size)
+		return
+	}
+	_, _ = io.CopyN(w, body, sendSize)
+}
+
+// fileETag возвращает сильный ETag файла. Обычно он строится из времени изменения и размера;
+// у файлов без времени изменения (например, из embed.FS) - из хеша содержимого, для чего файл
+// должен поддерживать Seek. Пустая строка - ETag построить нельзя.
+func fileETag(f fs.File, info fs.FileInfo) (string, error) {
+	if !info.ModTime().IsZero() {
+		return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()), nil
+	}
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		return "", nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`"%x"`, h.Sum(nil)[:16]), nil
+}
+
+// localRedirect перенаправляет на target относительно текущего пути, сохраняя query
+func localRedirect(w http.ResponseWriter, r *http.Request, target string) {
+	if q := r.URL.RawQuery; q != "" {
+		target += "?" + q
+	}
+	w.Header().Set("Location", target)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// writeFSError отвечает кодом, соответствующим ошибке файловой системы. Подробности
+// ошибки клиенту не отдаются: в них могут быть пути на сервере.
+func writeFSError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+		http.Error(w, "404 page not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	default:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,421 @@
+package static
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/client"
+	"github.com/tcarzverey/course-go-python/homeworks/hw2/myhttp/server"
+)
+
+var modTime = time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"home.html":          {Data: []byte("<html>chat</html>"), ModTime: modTime},
+		"data.bin":           {Data: []byte("0123456789abcdef"), ModTime: modTime},
+		"noext":              {Data: []byte("plain text"), ModTime: modTime},
+		"embedded.txt":       {Data: []byte("no modtime")},
+		"docs/index.html":    {Data: []byte("docs index"), ModTime: modTime},
+		"assets/app.js":      {Data: []byte("alert(1)"), ModTime: modTime},
+		"assets/<b>&x y.css": {Data: []byte("body{}"), ModTime: modTime},
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	etag := fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), 16)
+	lastModified := modTime.Format(http.TimeFormat)
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		method     string
+		target     string
+		header     http.Header
+		wantStatus int
+		wantHeader map[string]string
+		wantBody   string
+	}{
+		{
+			name:       "success: file with validators",
+			target:     "/data.bin",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{
+				"Content-Length": "16",
+				"ETag":           etag,
+				"Last-Modified":  lastModified,
+				"Accept-Ranges":  "bytes",
+			},
+			wantBody: "0123456789abcdef",
+		},
+		{
+			name:       "success: content type by extension",
+			target:     "/home.html",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "text/html; charset=utf-8"},
+			wantBody:   "<html>chat</html>",
+		},
+		{
+			name:       "success: content type sniffed",
+			target:     "/noext",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "text/plain; charset=utf-8"},
+			wantBody:   "plain text",
+		},
+		{
+			name:       "success: head without body",
+			method:     http.MethodHead,
+			target:     "/data.bin",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Length": "16"},
+		},
+		{
+			name:       "success: no modtime - etag from content",
+			target:     "/embedded.txt",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Last-Modified": "", "ETag": `"cc4f23f1f3f23a86a0b81b5021b3ea25"`},
+			wantBody:   "no modtime",
+		},
+		{
+			name:       "success: if-none-match",
+			target:     "/data.bin",
+			header:     http.Header{"If-None-Match": {`"other", W/` + etag}},
+			wantStatus: http.StatusNotModified,
+			wantHeader: map[string]string{"ETag": etag, "Content-Length": ""},
+		},
+		{
+			name:       "success: if-none-match mismatch wins over if-modified-since",
+			target:     "/data.bin",
+			header:     http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {lastModified}},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789abcdef",
+		},
+		{
+			name:       "success: if-modified-since",
+			target:     "/data.bin",
+			header:     http.Header{"If-Modified-Since": {lastModified}},
+			wantStatus: http.StatusNotModified,
+		},
+		{
+			name:       "success: modified after if-modified-since",
+			target:     "/data.bin",
+			header:     http.Header{"If-Modified-Since": {modTime.Add(-time.Hour).Format(http.TimeFormat)}},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789abcdef",
+		},
+		{
+			name:       "success: if-match failed",
+			target:     "/data.bin",
+			header:     http.Header{"If-Match": {`"other"`}},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "success: single range",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=2-5"}},
+			wantStatus: http.StatusPartialContent,
+			wantHeader: map[string]string{"Content-Range": "bytes 2-5/16", "Content-Length": "4"},
+			wantBody:   "2345",
+		},
+		{
+			name:       "success: suffix range",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=-3"}},
+			wantStatus: http.StatusPartialContent,
+			wantHeader: map[string]string{"Content-Range": "bytes 13-15/16"},
+			wantBody:   "def",
+		},
+		{
+			name:       "success: open range clipped to size",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=14-100"}},
+			wantStatus: http.StatusPartialContent,
+			wantHeader: map[string]string{"Content-Range": "bytes 14-15/16"},
+			wantBody:   "ef",
+		},
+		{
+			name:       "success: if-range mismatch - full file",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=2-5"}, "If-Range": {`"other"`}},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789abcdef",
+		},
+		{
+			name:       "success: if-range by date",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=0-0"}, "If-Range": {lastModified}},
+			wantStatus: http.StatusPartialContent,
+			wantBody:   "0",
+		},
+		{
+			name:       "success: malformed range ignored",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=5-2"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789abcdef",
+		},
+		{
+			name:       "success: overlapping ranges - full file",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=0-15,0-15"}},
+			wantStatus: http.StatusOK,
+			wantBody:   "0123456789abcdef",
+		},
+		{
+			name:       "success: index.html for directory",
+			target:     "/docs/",
+			wantStatus: http.StatusOK,
+			wantBody:   "docs index",
+		},
+		{
+			name:       "success: directory listing",
+			opts:       []Option{WithDirectoryListing()},
+			target:     "/assets/",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "text/html; charset=utf-8"},
+			wantBody: "<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n" +
+				"<a href=\"%3Cb%3E&amp;x%20y.css\">&lt;b&gt;&amp;x y.css</a>\n" +
+				"<a href=\"app.js\">app.js</a>\n</pre>\n",
+		},
+		{
+			name:       "success: directory redirect",
+			target:     "/docs?v=1",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: map[string]string{"Location": "docs/?v=1"},
+		},
+		{
+			name:       "success: file redirect",
+			target:     "/assets/app.js/",
+			wantStatus: http.StatusMovedPermanently,
+			wantHeader: map[string]string{"Location": "../app.js"},
+		},
+		{
+			name:       "failed: listing disabled",
+			target:     "/assets/",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "failed: not found",
+			target:     "/missing.txt",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "failed: path traversal",
+			target:     "/../../etc/passwd",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "failed: range past end",
+			target:     "/data.bin",
+			header:     http.Header{"Range": {"bytes=100-"}},
+			wantStatus: http.StatusRequestedRangeNotSatisfiable,
+			wantHeader: map[string]string{"Content-Range": "bytes */16"},
+		},
+		{
+			name:       "failed: method not allowed",
+			method:     http.MethodPost,
+			target:     "/data.bin",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "GET, HEAD"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.target, nil)
+			for key, values := range tt.header {
+				req.Header[key] = values
+			}
+			rec := httptest.NewRecorder()
+
+			New(testFS(), tt.opts...).ServeHTTP(rec, req)
+
+			assert.Equal(t, tt.wantStatus, rec.Code)
+			for key, want := range tt.wantHeader {
+				assert.Equal(t, want, rec.Header().Get(key), key)
+			}
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestFileServer_MultipleRanges(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/data.bin", nil)
+	req.Header.Set("Range", "bytes=0-1, 10-, -2")
+	rec := httptest.NewRecorder()
+
+	New(testFS()).ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, fmt.Sprint(rec.Body.Len()), rec.Header().Get("Content-Length"))
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/byteranges", mediaType)
+
+	type part struct{ contentRange, body string }
+	var got []part
+	mr := multipart.NewReader(rec.Body, params["boundary"])
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, "application/octet-stream", p.Header.Get("Content-Type"))
+		body, err := io.ReadAll(p)
+		require.NoError(t, err)
+		got = append(got, part{p.Header.Get("Content-Range"), string(body)})
+	}
+	assert.Equal(t, []part{
+		{"bytes 0-1/16", "01"},
+		{"bytes 10-15/16", "abcdef"},
+		{"bytes 14-15/16", "ef"},
+	}, got)
+}
+
+func TestFileServer_MyHTTPServer(t *testing.T) {
+	// файл заметно больше буфера ответа сервера - он должен уйти потоком с Content-Length
+	large := bytes.Repeat([]byte("0123456789"), 100_000)
+	fsys := fstest.MapFS{"large.bin": {Data: large, ModTime: modTime}}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	srv := server.New()
+	go func() {
+		if err := srv.Serve(l, New(fsys)); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Println("server error", err)
+		}
+	}()
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		method     string
+		rangeSpec  string
+		wantStatus int
+		wantLength int64
+		wantBody   []byte
+	}{
+		{
+			name:       "success: whole file",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+			wantLength: int64(len(large)),
+			wantBody:   large,
+		},
+		{
+			name:       "success: head keeps length",
+			method:     http.MethodHead,
+			wantStatus: http.StatusOK,
+			wantLength: int64(len(large)),
+			wantBody:   []byte{},
+		},
+		{
+			name:       "success: range",
+			method:     http.MethodGet,
+			rangeSpec:  "bytes=500000-500009",
+			wantStatus: http.StatusPartialContent,
+			wantLength: 10,
+			wantBody:   large[500000:500010],
+		},
+	}
+
+	c := client.New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, "http://"+addr+"/large.bin", nil)
+			require.NoError(t, err)
+			if tt.rangeSpec != "" {
+				req.Header.Set("Range", tt.rangeSpec)
+			}
+			resp, err := c.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantLength, resp.ContentLength)
+			assert.Empty(t, resp.TransferEncoding)
+			assert.True(t, bytes.Equal(tt.wantBody, body), "body mismatch")
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    []byteRange
+		wantErr error
+	}{
+		{header: "bytes=0-0", want: []byteRange{{0, 1}}},
+		{header: "bytes= 1-2 , 4-", want: []byteRange{{1, 2}, {4, 6}}},
+		{header: "bytes=-20", want: []byteRange{{0, 10}}},
+		{header: "bytes=20-,3-3", want: []byteRange{{3, 1}}},
+		{header: "bytes=20-", wantErr: errUnsatisfiable},
+		{header: "bytes=-0", wantErr: errUnsatisfiable},
+		{header: "items=0-1"},
+		{header: "bytes=+1-2"},
+		{header: "bytes=1"},
+		{header: "bytes=3-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			got, err := parseRange(tt.header, 10)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMatchETag(t *testing.T) {
+	tests := []struct {
+		list string
+		etag string
+		weak bool
+		want bool
+	}{
+		{list: `"a"`, etag: `"a"`, want: true},
+		{list: `"x,y", "a"`, etag: `"a"`, want: true},
+		{list: `W/"a"`, etag: `"a"`, want: false},
+		{list: `W/"a"`, etag: `"a"`, weak: true, want: true},
+		{list: `*`, etag: `"a"`, want: true},
+		{list: `"b"`, etag: `"a"`, weak: true, want: false},
+		{list: `a`, etag: `"a"`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchETag(tt.list, tt.etag, tt.weak))
+		})
+	}
+}
+
+func TestCutETag(t *testing.T) {
+	tag, rest, ok := cutETag(`W/"a,b" , "c"`)
+	require.True(t, ok)
+	assert.Equal(t, `W/"a,b"`, tag)
+	assert.True(t, strings.HasPrefix(rest, " ,"))
+}